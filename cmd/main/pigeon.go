@@ -3,24 +3,36 @@ package main
 import (
 	"context"
 	"flag"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/diamondburned/arikawa/v3/gateway"
 	"github.com/diamondburned/arikawa/v3/session"
+	"github.com/trondhumbor/pigeon/internal/command/admin"
 	"github.com/trondhumbor/pigeon/internal/command/serveralive"
 	"github.com/trondhumbor/pigeon/internal/command/serverlist"
 	"github.com/trondhumbor/pigeon/internal/command/stats"
+	"github.com/trondhumbor/pigeon/internal/command/status"
+	"github.com/trondhumbor/pigeon/internal/logging"
 	"github.com/trondhumbor/pigeon/internal/server"
 )
 
 // CommandCreators is the list of handlers of the commands that are active
 var CommandCreators = []server.CreateCommand{
+	admin.CreateCommand,
 	serveralive.CreateCommand,
 	serverlist.CreateCommand,
 	stats.CreateCommand,
+	status.CreateCommand,
+}
+
+// fatal logs the error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
 
 func main() {
@@ -35,21 +47,35 @@ func main() {
 		false,
 		"if true, the program will delete all guild commands on startup, and then exit")
 
+	logflags := logging.Config{}
+	flag.StringVar(&logflags.Level, "loglevel", "", "log level: debug, info, warn or error (default info)")
+	flag.StringVar(&logflags.Format, "logformat", "", "log format: logfmt or json (default logfmt)")
+	flag.StringVar(&logflags.Output, "logoutput", "", "log output: stderr, stdout or a file path (default stderr)")
+
 	flag.Parse()
 
-	log.Println("starting pigeon")
+	// log according to the flags until the config is read
+	if err := logging.Setup(logflags); err != nil {
+		fatal("error setting up logging", err)
+	}
+	defer logging.Close()
+
+	slog.Info("starting pigeon")
 	srv, err := server.New(*configpath)
 	if err != nil {
-		log.Fatal(err)
+		fatal("error creating server", err)
+	}
+
+	if err := logging.Setup(srv.Log.Merge(logflags)); err != nil {
+		fatal("error setting up logging", err)
 	}
 
-	log.Println("creating discord session")
+	slog.Info("creating discord session")
 	sess := session.New("Bot " + srv.Token)
 
-	log.Println("adding handlers and intents")
+	slog.Info("adding handlers and intents")
 	sess.AddHandler(srv.MessageCreateHandler)
 	sess.AddHandler(srv.HandleInteraction)
-	// sess.AddHandler(srv.HandleComponentInteraction)
 
 	sess.AddIntents(gateway.IntentGuilds)
 	sess.AddIntents(gateway.IntentGuildMessages)
@@ -57,37 +83,51 @@ func main() {
 	sess.AddIntents(gateway.IntentDirectMessages)
 	sess.AddIntents(gateway.IntentGuildMessageReactions)
 
-	log.Println("opening discord session")
-	err = sess.Open(context.Background())
+	// ctx is cancelled on shutdown, stopping the cache refreshes and the queries in flight
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	slog.Info("opening discord session")
+	err = sess.Open(ctx)
 	if err != nil {
-		log.Fatalf("error opening connection: %v", err)
+		fatal("error opening connection", err)
 		return
 	}
 
 	defer sess.Close()
 
-	log.Println("initializing server")
-	err = srv.Initialize(sess, CommandCreators)
+	slog.Info("initializing server")
+	err = srv.Initialize(ctx, sess, CommandCreators)
 	if err != nil {
-		log.Fatalf("error initializing server: %v", err)
+		fatal("error initializing server", err)
 		return
 	}
 
 	if deletecommands != nil && *deletecommands {
-		log.Println("deletecommands flag detected, deleting guild commands...")
+		slog.Info("deletecommands flag detected, deleting guild commands...")
 		err = srv.DeleteGuildCommands()
 		if err != nil {
-			log.Fatalf("error deleting commands: %v", err)
+			fatal("error deleting commands", err)
 		}
 
-		log.Println("deleted commands, exiting...")
+		slog.Info("deleted commands, exiting...")
 		os.Exit(0)
 	}
 
-	log.Println("Bot is now running.  Press CTRL-C to exit.")
+	slog.Info("Bot is now running.  Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	sigRec := <-sc
 
-	log.Printf("signal %v received, exiting...", sigRec)
+	slog.Info("signal received, exiting...", "signal", sigRec)
+	cancel()
+
+	// give the replies in flight some time to finish before the session closes
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil {
+		slog.Error("error shutting down server", "err", err)
+	}
 }
@@ -9,4 +9,4 @@ require (
 	golang.org/x/time v0.0.0-20210723032227-1f47c861a9ac // indirect
 )
 
-go 1.17
+go 1.21
@@ -0,0 +1,245 @@
+package colors
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Color is one of the 8 colors of the Quake 3 palette
+type Color int
+
+// The colors of the Quake 3 palette, in the order of the codes ^0 to ^7
+const (
+	Black Color = iota
+	Red
+	Green
+	Yellow
+	Blue
+	Cyan
+	Magenta
+	White
+)
+
+// Default is the color of text before any color code
+const Default = White
+
+// RawSuffix is appended to an info key to keep its value with the color codes, once stripped
+const RawSuffix = "_raw"
+
+// palette holds the RGB values of the colors, to find the one nearest to a hex color
+var palette = [...][3]int{
+	Black:   {0, 0, 0},
+	Red:     {255, 0, 0},
+	Green:   {0, 255, 0},
+	Yellow:  {255, 255, 0},
+	Blue:    {0, 0, 255},
+	Cyan:    {0, 255, 255},
+	Magenta: {255, 0, 255},
+	White:   {255, 255, 255},
+}
+
+// ansiCodes are the foreground colors of Discord's ansi code blocks. Black is rendered gray, as
+// it would be unreadable on the dark theme.
+var ansiCodes = [...]int{
+	Black:   30,
+	Red:     31,
+	Green:   32,
+	Yellow:  33,
+	Blue:    34,
+	Cyan:    36,
+	Magenta: 35,
+	White:   37,
+}
+
+// Span is a run of text in a single color
+type Span struct {
+	Text  string
+	Color Color
+}
+
+// Parse splits s into spans of the same color. It understands
+//   - ^ followed by a digit or letter, or : and ; as used by some forks, mapped onto the 8 colors
+//     the way Quake 3 does, so ^0 to ^7 are the palette and ^8 and up wrap around
+//   - ^xRGB with R, G and B hex digits, as used by Darkplaces based games, mapped to the nearest color
+//   - ^^ for a literal ^
+//
+// Any other ^ is kept as text. Control characters are dropped, so they can't inject escape codes.
+func Parse(s string) []Span {
+	var spans []Span
+	var text strings.Builder
+	color := Default
+
+	flush := func() {
+		if text.Len() > 0 {
+			spans = append(spans, Span{Text: text.String(), Color: color})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '^' && i+1 < len(s) {
+			next := s[i+1]
+			switch {
+			case next == '^':
+				text.WriteByte('^')
+				i++
+				continue
+
+			case next == 'x' && i+4 < len(s) && isHex(s[i+2:i+5]):
+				flush()
+				color = nearest(s[i+2 : i+5])
+				i += 4
+				continue
+
+			case isAlnum(next) || next == ':' || next == ';':
+				flush()
+				color = Color((int(next) - '0') & 7)
+				i++
+				continue
+			}
+		}
+
+		if c < 0x20 || c == 0x7F {
+			continue
+		}
+		text.WriteByte(c)
+	}
+	flush()
+
+	return spans
+}
+
+// Strip returns s without its color codes
+func Strip(s string) string {
+	return Plain(Parse(s))
+}
+
+// Plain renders the spans as text without colors
+func Plain(spans []Span) string {
+	var b strings.Builder
+	for _, span := range spans {
+		b.WriteString(span.Text)
+	}
+	return b.String()
+}
+
+// ANSI renders the spans with the escape codes of Discord's ansi code blocks, and resets the color
+// at the end
+func ANSI(spans []Span) string {
+	var b strings.Builder
+	for _, span := range spans {
+		b.WriteString("\x1b[0;" + strconv.Itoa(ansiCodes[span.Color]) + "m")
+		b.WriteString(span.Text)
+	}
+	if len(spans) > 0 {
+		b.WriteString("\x1b[0m")
+	}
+	return b.String()
+}
+
+// Len returns the length of the text of the spans, in bytes
+func Len(spans []Span) int {
+	n := 0
+	for _, span := range spans {
+		n += len(span.Text)
+	}
+	return n
+}
+
+// Truncate returns the spans cut off after at most n bytes of text, never within a UTF-8 sequence
+func Truncate(spans []Span, n int) []Span {
+	var ret []Span
+	for _, span := range spans {
+		if n <= 0 {
+			break
+		}
+		if len(span.Text) > n {
+			cut := n
+			for cut > 0 && !utf8.RuneStart(span.Text[cut]) {
+				cut--
+			}
+			if cut > 0 {
+				ret = append(ret, Span{Text: span.Text[:cut], Color: span.Color})
+			}
+			break
+		}
+		n -= len(span.Text)
+		ret = append(ret, span)
+	}
+	return ret
+}
+
+// TrimRight returns the spans without trailing spaces
+func TrimRight(spans []Span) []Span {
+	ret := append([]Span(nil), spans...)
+	for len(ret) > 0 {
+		last := &ret[len(ret)-1]
+		last.Text = strings.TrimRight(last.Text, " ")
+		if last.Text != "" {
+			break
+		}
+		ret = ret[:len(ret)-1]
+	}
+	return ret
+}
+
+// StripInfo strips the color codes from the values of the given keys of a server's info. Values
+// which had color codes are kept as they were under the key followed by RawSuffix.
+func StripInfo(info map[string]string, keys ...string) {
+	for _, key := range keys {
+		value, present := info[key]
+		if !present {
+			continue
+		}
+		if stripped := Strip(value); stripped != value {
+			info[key] = stripped
+			info[key+RawSuffix] = value
+		}
+	}
+}
+
+// Raw returns the value of the key of a server's info with its color codes, if it had any
+func Raw(info map[string]string, key string) string {
+	if value, present := info[key+RawSuffix]; present {
+		return value
+	}
+	return info[key]
+}
+
+func isAlnum(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// nearest returns the palette color nearest to the 3 hex digit RGB color
+func nearest(rgb string) Color {
+	var target [3]int
+	for i := range target {
+		v, _ := strconv.ParseInt(rgb[i:i+1], 16, 0)
+		target[i] = int(v) * 17 // scale 0-15 to 0-255
+	}
+
+	best, bestDistance := Default, -1
+	for c, p := range palette {
+		distance := 0
+		for i := range p {
+			d := p[i] - target[i]
+			distance += d * d
+		}
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = Color(c), distance
+		}
+	}
+	return best
+}
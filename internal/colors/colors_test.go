@@ -0,0 +1,108 @@
+package colors
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []Span
+	}{
+		{"", nil},
+		{"plain", []Span{{"plain", White}}},
+		{"^1red^2green", []Span{{"red", Red}, {"green", Green}}},
+		{"^1^2green", []Span{{"green", Green}}},
+		{"^8black^9red", []Span{{"black", Black}, {"red", Red}}},
+		{"^ared^;yellow^:green", []Span{{"red", Red}, {"yellow", Yellow}, {"green", Green}}},
+		{"^xF00red^x0f0green^x00fblue", []Span{{"red", Red}, {"green", Green}, {"blue", Blue}}},
+		{"^x888gray^xEEEwhite", []Span{{"gray", White}, {"white", White}}},
+		{"^x12", []Span{{"12", Black}}},
+		{"^xg00", []Span{{"g00", Black}}},
+		{"a^^1b", []Span{{"a^1b", White}}},
+		{"^^", []Span{{"^", White}}},
+		{"^1a^^^2b", []Span{{"a^", Red}, {"b", Green}}},
+		{"trailing^", []Span{{"trailing^", White}}},
+		{"^1trailing^", []Span{{"trailing^", Red}}},
+		{"^ space^!", []Span{{"^ space^!", White}}},
+		{"a\x1b[31mb\x7fc\n\td", []Span{{"a[31mbcd", White}}},
+		{"^1\x00\x01", nil},
+		{"^3Æøå", []Span{{"Æøå", Yellow}}},
+	}
+
+	for _, tt := range tests {
+		if got := Parse(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"^1Pi^7geon", "Pigeon"},
+		{"^xf0fD^xF0Fark^7Places", "DarkPlaces"},
+		{"2^^3", "2^3"},
+		{"100%^", "100%^"},
+		{"bell\x07", "bell"},
+	}
+
+	for _, tt := range tests {
+		if got := Strip(tt.in); got != tt.want {
+			t.Errorf("Strip(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want []Span
+	}{
+		{"^1abc^2def", 10, []Span{{"abc", Red}, {"def", Green}}},
+		{"^1abc^2def", 4, []Span{{"abc", Red}, {"d", Green}}},
+		{"^1abc^2def", 3, []Span{{"abc", Red}}},
+		{"^1abc^2def", 0, nil},
+		// Æ is 2 bytes, so 3 bytes can only hold one of them
+		{"^1ÆÆÆ", 3, []Span{{"Æ", Red}}},
+		{"^1ÆÆÆ", 1, nil},
+		{"^1a^2ÆÆ", 4, []Span{{"a", Red}, {"Æ", Green}}},
+		{"^1a^2ÆÆ", 2, []Span{{"a", Red}}},
+	}
+
+	for _, tt := range tests {
+		got := Truncate(Parse(tt.in), tt.n)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Truncate(Parse(%q), %d) = %v, want %v", tt.in, tt.n, got, tt.want)
+		}
+		if !utf8.ValidString(Plain(got)) {
+			t.Errorf("Truncate(Parse(%q), %d) cut a UTF-8 sequence: %q", tt.in, tt.n, Plain(got))
+		}
+	}
+}
+
+func TestStripInfo(t *testing.T) {
+	info := map[string]string{"hostname": "^1Red ^7server", "mapname": "q3dm17", "g_motd": "^2hi"}
+	StripInfo(info, "hostname", "mapname", "missing")
+
+	want := map[string]string{
+		"hostname":             "Red server",
+		"hostname" + RawSuffix: "^1Red ^7server",
+		"mapname":              "q3dm17",
+		"g_motd":               "^2hi",
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("StripInfo() = %v, want %v", info, want)
+	}
+	if got := Raw(info, "hostname"); got != "^1Red ^7server" {
+		t.Errorf("Raw(hostname) = %q, want the value with color codes", got)
+	}
+	if got := Raw(info, "mapname"); got != "q3dm17" {
+		t.Errorf("Raw(mapname) = %q, want %q", got, "q3dm17")
+	}
+}
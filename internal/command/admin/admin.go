@@ -0,0 +1,356 @@
+package admin
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/session"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+	"github.com/trondhumbor/pigeon/internal/command"
+	"github.com/trondhumbor/pigeon/internal/query"
+	"github.com/trondhumbor/pigeon/internal/server"
+	"github.com/trondhumbor/pigeon/internal/stringformat"
+)
+
+const commandName = "admin"
+
+type adminHandler struct {
+	session   *session.Session
+	server    *server.Server
+	formatter stringformat.Formatter
+}
+
+// CreateCommand creates a SlashCommand which handles /admin
+func CreateCommand(srv *server.Server) (cmd command.SlashCommand, err error) {
+	ah := adminHandler{session: srv.Session, server: srv, formatter: stringformat.New(srv.Aliases)}
+
+	gameOption := func(description string) *discord.StringOption {
+		return &discord.StringOption{
+			OptionName:   "game",
+			Description:  description,
+			Required:     true,
+			Autocomplete: true,
+		}
+	}
+
+	cmd = command.SlashCommand{
+		HandleInteraction:  ah.handleInteraction,
+		HandleAutocomplete: ah.handleAutocomplete,
+		CommandData: api.CreateCommandData{
+			Name:        commandName,
+			Description: "manage the bot",
+			Options: []discord.CommandOption{
+				&discord.SubcommandOption{
+					OptionName:  "refresh",
+					Description: "query every master server again now",
+				},
+				&discord.SubcommandOption{
+					OptionName:  "health",
+					Description: "show the state of the bot",
+				},
+				&discord.SubcommandGroupOption{
+					OptionName:  "master",
+					Description: "manage master servers",
+					Subcommands: []*discord.SubcommandOption{
+						{
+							OptionName:  "add",
+							Description: "add a master server, or change the endpoints, protocol and version of an existing one",
+							Options: []discord.CommandOptionValue{
+								&discord.StringOption{
+									OptionName:  "game",
+									Description: "the gamename servers report",
+									Required:    true,
+								},
+								&discord.StringOption{
+									OptionName:  "endpoint",
+									Description: "host:port of the master server, several may be separated by commas",
+									Required:    true,
+								},
+								&discord.StringOption{
+									OptionName:  "protocol",
+									Description: "query protocol of the game, q3 if not given",
+									Choices:     protocolChoices(),
+								},
+								&discord.IntegerOption{
+									OptionName:  "version",
+									Description: "protocol version to request servers for, required for q3",
+								},
+								&discord.BooleanOption{
+									OptionName:  "ipv6",
+									Description: "also request IPv6 servers, if the master supports it, unchanged if not given",
+								},
+							},
+						},
+						{
+							OptionName:  "remove",
+							Description: "remove a master server",
+							Options:     []discord.CommandOptionValue{gameOption("game of the master server to remove")},
+						},
+						{
+							OptionName:  "disable",
+							Description: "stop querying a master server",
+							Options:     []discord.CommandOptionValue{gameOption("game of the master server to disable")},
+						},
+						{
+							OptionName:  "enable",
+							Description: "resume querying a disabled master server",
+							Options:     []discord.CommandOptionValue{gameOption("game of the master server to enable")},
+						},
+					},
+				},
+				&discord.SubcommandGroupOption{
+					OptionName:  "alias",
+					Description: "manage the names shown for maps and gametypes",
+					Subcommands: []*discord.SubcommandOption{
+						{
+							OptionName:  "map",
+							Description: "set the name shown for a mapname",
+							Options: []discord.CommandOptionValue{
+								&discord.StringOption{OptionName: "mapname", Description: "mapname reported by servers", Required: true},
+								&discord.StringOption{OptionName: "alias", Description: "name to show", Required: true},
+							},
+						},
+						{
+							OptionName:  "gametype",
+							Description: "set the name shown for a gametype",
+							Options: []discord.CommandOptionValue{
+								&discord.StringOption{OptionName: "gametype", Description: "gametype reported by servers", Required: true},
+								&discord.StringOption{OptionName: "alias", Description: "name to show", Required: true},
+							},
+						},
+					},
+				},
+				&discord.SubcommandGroupOption{
+					OptionName:  "blocklist",
+					Description: "manage servers which are never listed",
+					Subcommands: []*discord.SubcommandOption{
+						{
+							OptionName:  "add",
+							Description: "blocklist an ip, ip:port or CIDR range",
+							Options: []discord.CommandOptionValue{
+								&discord.StringOption{OptionName: "address", Description: "ip, ip:port or CIDR range", Required: true},
+							},
+						},
+						{
+							OptionName:  "remove",
+							Description: "remove an entry from the blocklist",
+							Options: []discord.CommandOptionValue{
+								&discord.StringOption{OptionName: "address", Description: "blocklist entry", Required: true, Autocomplete: true},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return
+}
+
+// subcommand returns the invoked subcommand, e.g. "master add", together with its options
+func subcommand(options map[string]discord.CommandInteractionOption) (path string, args map[string]discord.CommandInteractionOption) {
+	var names []string
+	ops := options
+	for len(ops) == 1 {
+		var op discord.CommandInteractionOption
+		for _, o := range ops {
+			op = o
+		}
+		if op.Type != discord.SubcommandOptionType && op.Type != discord.SubcommandGroupOptionType {
+			break
+		}
+
+		names = append(names, op.Name)
+		ops = make(map[string]discord.CommandInteractionOption)
+		for _, o := range op.Options {
+			ops[o.Name] = o
+		}
+	}
+	return strings.Join(names, " "), ops
+}
+
+// protocolChoices offers the query drivers which can list servers from a master server, given
+// whatever options they need
+func protocolChoices() []discord.StringChoice {
+	var choices []discord.StringChoice
+	for _, name := range query.Drivers() {
+		driver, _ := query.Lookup(name)
+		if query.CheckList(driver, query.ListOptions{Version: 1}) != nil {
+			continue
+		}
+		choices = append(choices, discord.StringChoice{Name: name, Value: name})
+	}
+	return choices
+}
+
+func reply(format string, a ...interface{}) *api.InteractionResponseData {
+	return &api.InteractionResponseData{
+		Content: option.NewNullableString(fmt.Sprintf(format, a...)),
+		Flags:   api.EphemeralResponse,
+	}
+}
+
+//revive:disable-next-line:cyclomatic
+func (ah *adminHandler) handleInteraction(
+	event *gateway.InteractionCreateEvent, options map[string]discord.CommandInteractionOption,
+) (
+	response *api.InteractionResponseData, err error,
+) {
+	admin, err := ah.server.IsAdmin(event.ChannelID, event.Member)
+	if err != nil {
+		return nil, fmt.Errorf("checking admin permissions: %v", err)
+	}
+	if !admin {
+		return reply("you are not allowed to use this command."), nil
+	}
+
+	path, args := subcommand(options)
+	switch path {
+	case "refresh":
+		ah.server.Refresh()
+		return reply("refreshing the server cache."), nil
+
+	case "health":
+		return reply("%s", ah.formatter.Health(ah.server.Health())), nil
+
+	case "master add":
+		var endpoints []string
+		for _, endpoint := range strings.Split(args["endpoint"].String(), ",") {
+			endpoint = strings.TrimSpace(endpoint)
+			if _, _, err := net.SplitHostPort(endpoint); err != nil {
+				return reply("invalid endpoint %q, expected host:port", endpoint), nil
+			}
+			endpoints = append(endpoints, endpoint)
+		}
+		master := server.MasterServer{
+			GameId:    args["game"].String(),
+			Protocol:  query.DefaultDriver,
+			Endpoint:  endpoints[0],
+			Endpoints: endpoints[1:],
+		}
+		if protocol, present := args["protocol"]; present {
+			master.Protocol = protocol.String()
+		}
+		if version, present := args["version"]; present {
+			v, err := version.IntValue()
+			if err != nil {
+				return nil, fmt.Errorf("reading version: %v", err)
+			}
+			master.Version = int(v)
+		}
+		if ipv6, present := args["ipv6"]; present {
+			var err error
+			if master.IPv6, err = ipv6.BoolValue(); err != nil {
+				return nil, fmt.Errorf("reading ipv6: %v", err)
+			}
+		} else {
+			for _, m := range ah.server.Masters() {
+				if strings.EqualFold(m.GameId, master.GameId) {
+					master.IPv6 = m.IPv6
+				}
+			}
+		}
+		if err := master.Validate(); err != nil {
+			return reply("%v", err), nil
+		}
+		if err := ah.server.AddMaster(master); err != nil {
+			return nil, err
+		}
+		ah.server.Refresh()
+		return reply("added master server %s for %s.", strings.Join(endpoints, ", "), master.GameId), nil
+
+	case "master remove":
+		if err := ah.server.RemoveMaster(args["game"].String()); err != nil {
+			return reply("%v", err), nil
+		}
+		return reply("removed master server for %s.", args["game"].String()), nil
+
+	case "master disable", "master enable":
+		disabled := path == "master disable"
+		if err := ah.server.SetMasterDisabled(args["game"].String(), disabled); err != nil {
+			return reply("%v", err), nil
+		}
+		if !disabled {
+			ah.server.Refresh()
+		}
+		return reply("%sd master server for %s.", strings.TrimPrefix(path, "master "), args["game"].String()), nil
+
+	case "alias map":
+		if err := ah.server.AddMapnameAlias(args["mapname"].String(), args["alias"].String()); err != nil {
+			return nil, err
+		}
+		return reply("%s is now shown as %s.", args["mapname"].String(), args["alias"].String()), nil
+
+	case "alias gametype":
+		if err := ah.server.AddGametypeAlias(args["gametype"].String(), args["alias"].String()); err != nil {
+			return nil, err
+		}
+		return reply("%s is now shown as %s.", args["gametype"].String(), args["alias"].String()), nil
+
+	case "blocklist add":
+		address := args["address"].String()
+		if !validAddress(address) {
+			return reply("invalid address %q, expected an ip, ip:port or CIDR range", address), nil
+		}
+		if err := ah.server.AddToBlocklist(address); err != nil {
+			return reply("%v", err), nil
+		}
+		return reply("blocklisted %s, it will be gone after the next refresh.", address), nil
+
+	case "blocklist remove":
+		if err := ah.server.RemoveFromBlocklist(args["address"].String()); err != nil {
+			return reply("%v", err), nil
+		}
+		return reply("removed %s from the blocklist.", args["address"].String()), nil
+	}
+
+	return nil, fmt.Errorf("unknown admin subcommand %q", path)
+}
+
+func validAddress(address string) bool {
+	if _, _, err := net.ParseCIDR(address); err == nil {
+		return true
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	return net.ParseIP(address) != nil
+}
+
+func (ah *adminHandler) handleAutocomplete(
+	event *gateway.InteractionCreateEvent,
+	focused discord.AutocompleteOption,
+	options map[string]discord.AutocompleteOption,
+) (
+	choices []api.AutocompleteChoice, err error,
+) {
+	admin, err := ah.server.IsAdmin(event.ChannelID, event.Member)
+	if err != nil {
+		return nil, fmt.Errorf("checking admin permissions: %v", err)
+	}
+	if !admin {
+		return nil, nil
+	}
+
+	switch focused.Name {
+	case "game":
+		// disabled games are included, as they can be enabled or removed
+		for _, m := range ah.server.Masters() {
+			if strings.Contains(strings.ToLower(m.GameId), strings.ToLower(focused.Value)) {
+				choices = append(choices, api.AutocompleteChoice{Name: m.GameId, Value: m.GameId})
+			}
+		}
+	case "address":
+		blocklist, _ := ah.server.AddressLists()
+		for _, entry := range blocklist {
+			if strings.Contains(entry, focused.Value) {
+				choices = append(choices, api.AutocompleteChoice{Name: entry, Value: entry})
+			}
+		}
+	}
+	return
+}
@@ -1,11 +1,16 @@
 package command
 
 import (
+	"strings"
+
 	"github.com/diamondburned/arikawa/v3/api"
 	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/diamondburned/arikawa/v3/gateway"
 )
 
+// customIDSeparator separates the command name and arguments in a namespaced custom ID
+const customIDSeparator = ":"
+
 // SlashCommand is data about a command and the function to handle interactions in the way described
 // by the data
 type SlashCommand struct {
@@ -14,4 +19,39 @@ type SlashCommand struct {
 		event *gateway.InteractionCreateEvent,
 		options map[string]discord.CommandInteractionOption,
 	) (*api.InteractionResponseData, error)
+
+	// HandleComponent is optional, and handles buttons and select menus whose custom ID is
+	// namespaced to this command. args are the parts of the custom ID following the command name.
+	HandleComponent func(
+		event *gateway.InteractionCreateEvent,
+		data discord.ComponentInteraction,
+		args []string,
+	) (*api.InteractionResponse, error)
+
+	// HandleModal is optional, and handles submitted modals whose custom ID is namespaced to
+	// this command. args are the parts of the custom ID following the command name.
+	HandleModal func(
+		event *gateway.InteractionCreateEvent,
+		data *discord.ModalInteraction,
+		args []string,
+	) (*api.InteractionResponse, error)
+
+	// HandleAutocomplete is optional, and returns the suggestions for the focused option
+	HandleAutocomplete func(
+		event *gateway.InteractionCreateEvent,
+		focused discord.AutocompleteOption,
+		options map[string]discord.AutocompleteOption,
+	) ([]api.AutocompleteChoice, error)
+}
+
+// CustomID creates a custom ID for a component or modal which is routed back to the command with
+// the given name
+func CustomID(commandName string, args ...string) discord.ComponentID {
+	return discord.ComponentID(strings.Join(append([]string{commandName}, args...), customIDSeparator))
+}
+
+// ParseCustomID splits a custom ID created by CustomID into the command name and arguments
+func ParseCustomID(customID discord.ComponentID) (commandName string, args []string) {
+	parts := strings.Split(string(customID), customIDSeparator)
+	return parts[0], parts[1:]
 }
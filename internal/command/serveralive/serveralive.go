@@ -1,8 +1,7 @@
 package serveralive
 
 import (
-	"log"
-	"strings"
+	"fmt"
 
 	"github.com/diamondburned/arikawa/v3/api"
 	"github.com/diamondburned/arikawa/v3/discord"
@@ -10,10 +9,14 @@ import (
 	"github.com/diamondburned/arikawa/v3/session"
 	"github.com/diamondburned/arikawa/v3/utils/json/option"
 	"github.com/trondhumbor/pigeon/internal/command"
+	"github.com/trondhumbor/pigeon/internal/filter"
 	"github.com/trondhumbor/pigeon/internal/server"
+	"github.com/trondhumbor/pigeon/internal/sorting"
 	"github.com/trondhumbor/pigeon/internal/stringformat"
 )
 
+const commandName = "serveralive"
+
 type serveraliveHandler struct {
 	session   *session.Session
 	server    *server.Server
@@ -22,24 +25,38 @@ type serveraliveHandler struct {
 
 // CreateCommand creates a SlashCommand which handles /serveralive
 func CreateCommand(srv *server.Server) (cmd command.SlashCommand, err error) {
-	sh := serveraliveHandler{session: srv.Session, server: srv, formatter: stringformat.New(srv.Mapnames, srv.Gametypes)}
+	sh := serveraliveHandler{session: srv.Session, server: srv, formatter: stringformat.New(srv.Aliases)}
 
 	cmd = command.SlashCommand{
-		HandleInteraction: sh.handleInteraction,
+		HandleInteraction:  sh.handleInteraction,
+		HandleComponent:    sh.handleComponent,
+		HandleAutocomplete: sh.handleAutocomplete,
 		CommandData: api.CreateCommandData{
-			Name:        "serveralive",
+			Name:        commandName,
 			Description: "lists the servers for the given game",
 			Options: []discord.CommandOption{
 				&discord.StringOption{
-					OptionName:  "filter",
-					Description: "filter for servers with hostname",
-					Required:    true,
+					OptionName:   "filter",
+					Description:  "filter expression, e.g. map:crash players>=4 -hostname:test",
+					Required:     true,
+					Autocomplete: true,
+				},
+				&discord.StringOption{
+					OptionName:  "sort",
+					Description: "order to list the servers in, defaults to most players first",
+					Required:    false,
+					Choices:     sorting.Choices,
 				},
 				&discord.BooleanOption{
 					OptionName:  "mobile",
 					Description: "format serverlist for mobile devices",
 					Required:    false,
 				},
+				&discord.BooleanOption{
+					OptionName:  "colors",
+					Description: "show hostnames in their in-game colors, only visible on desktop",
+					Required:    false,
+				},
 			},
 		},
 	}
@@ -47,52 +64,50 @@ func CreateCommand(srv *server.Server) (cmd command.SlashCommand, err error) {
 	return
 }
 
-func (sh *serveraliveHandler) sendMessage(event *gateway.InteractionCreateEvent, options map[string]discord.CommandInteractionOption) {
-	var servers []server.GameServer
-	for _, v := range sh.server.GameServers {
-		servers = append(servers, v...)
-	}
+func (sh *serveraliveHandler) serverList(options map[string]discord.CommandInteractionOption) *api.InteractionResponseData {
+	servers := sh.server.AllServers()
 
 	if val, present := options["filter"]; present {
-		servers = filter(servers, val.String())
+		mapnames, gametypes := sh.server.Aliases()
+		f, err := filter.Parse(val.String(), mapnames, gametypes)
+		if err != nil {
+			return &api.InteractionResponseData{
+				Content: option.NewNullableString(fmt.Sprintf("invalid filter: %v", err)),
+			}
+		}
+		servers = f.Apply(servers)
 	}
 
 	if len(servers) == 0 {
-		_, mErr := sh.session.SendMessage(event.ChannelID, "no servers found for the specified filter.")
-		if mErr != nil {
-			log.Printf("error occured sending message")
+		return &api.InteractionResponseData{
+			Content: option.NewNullableString("no servers found for the specified filter."),
 		}
-		return
 	}
 
-	desc := sh.formatter.DesktopList(servers)
+	sorting.Sort(servers, sorting.OrderOption(options))
+
+	formatter := sh.formatter
+	if val, present := options["colors"]; present {
+		colored, err := val.BoolValue()
+		if err != nil {
+			colored = false
+		}
+		formatter = formatter.WithColors(colored)
+	}
+
+	desc := formatter.DesktopList(servers)
 	if val, present := options["mobile"]; present {
 		mobile, err := val.BoolValue()
 		if err != nil {
 			mobile = false
 		}
 		if mobile {
-			desc = sh.formatter.MobileList(servers)
+			desc = formatter.MobileList(servers)
 		}
 	}
-	for _, m := range desc {
-		_, mErr := sh.session.SendMessage(event.ChannelID, m)
-		if mErr != nil {
-			log.Printf("error occured sending message")
-		}
-	}
-}
+	desc = formatter.WithFooter(desc, formatter.Excluded(sh.server.AllExcluded()))
 
-func filter(list []server.GameServer, filterString string) []server.GameServer {
-	var ret []server.GameServer
-	for _, s := range list {
-		if val, present := s["hostname"]; present {
-			if strings.Contains(strings.ToLower(val), strings.ToLower(filterString)) {
-				ret = append(ret, s)
-			}
-		}
-	}
-	return ret
+	return sh.server.PaginatedResponse(commandName, desc)
 }
 
 func (sh *serveraliveHandler) handleInteraction(
@@ -100,10 +115,36 @@ func (sh *serveraliveHandler) handleInteraction(
 ) (
 	response *api.InteractionResponseData, err error,
 ) {
-	go sh.sendMessage(event, options)
+	response = sh.serverList(options)
+	return
+}
 
-	response = &api.InteractionResponseData{
-		Content: option.NewNullableString("sending filtered server list, please wait..."),
+func (sh *serveraliveHandler) handleComponent(
+	event *gateway.InteractionCreateEvent, data discord.ComponentInteraction, args []string,
+) (
+	response *api.InteractionResponse, err error,
+) {
+	return sh.server.PageResponse(commandName, args)
+}
+
+func (sh *serveraliveHandler) handleAutocomplete(
+	event *gateway.InteractionCreateEvent,
+	focused discord.AutocompleteOption,
+	options map[string]discord.AutocompleteOption,
+) (
+	choices []api.AutocompleteChoice, err error,
+) {
+	if focused.Name != "filter" {
+		return
+	}
+
+	// a hostname is suggested as a single term, quoted so it can't be mistaken for filter syntax
+	for _, c := range sh.server.HostnameChoices(focused.Value) {
+		quoted := filter.Quote(c.Value)
+		if len([]rune(quoted)) > 100 {
+			continue
+		}
+		choices = append(choices, api.AutocompleteChoice{Name: c.Name, Value: quoted})
 	}
 	return
 }
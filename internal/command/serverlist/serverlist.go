@@ -1,7 +1,7 @@
 package serverlist
 
 import (
-	"log"
+	"fmt"
 	"strconv"
 
 	"github.com/diamondburned/arikawa/v3/api"
@@ -10,10 +10,14 @@ import (
 	"github.com/diamondburned/arikawa/v3/session"
 	"github.com/diamondburned/arikawa/v3/utils/json/option"
 	"github.com/trondhumbor/pigeon/internal/command"
+	"github.com/trondhumbor/pigeon/internal/filter"
 	"github.com/trondhumbor/pigeon/internal/server"
+	"github.com/trondhumbor/pigeon/internal/sorting"
 	"github.com/trondhumbor/pigeon/internal/stringformat"
 )
 
+const commandName = "serverlist"
+
 type serverlistHandler struct {
 	session   *session.Session
 	server    *server.Server
@@ -22,31 +26,43 @@ type serverlistHandler struct {
 
 // CreateCommand creates a SlashCommand which handles /serverlist
 func CreateCommand(srv *server.Server) (cmd command.SlashCommand, err error) {
-	sh := serverlistHandler{session: srv.Session, server: srv, formatter: stringformat.New(srv.Mapnames, srv.Gametypes)}
-
-	choices := []discord.StringChoice{}
-	for _, master := range srv.MasterServers {
-		gameId := master.GameId
-		choices = append(choices, discord.StringChoice{Name: gameId, Value: gameId})
-	}
+	sh := serverlistHandler{session: srv.Session, server: srv, formatter: stringformat.New(srv.Aliases)}
 
 	cmd = command.SlashCommand{
-		HandleInteraction: sh.handleInteraction,
+		HandleInteraction:  sh.handleInteraction,
+		HandleComponent:    sh.handleComponent,
+		HandleAutocomplete: sh.handleAutocomplete,
 		CommandData: api.CreateCommandData{
-			Name:        "serverlist",
+			Name:        commandName,
 			Description: "lists the servers for the given game",
 			Options: []discord.CommandOption{
 				&discord.StringOption{
-					OptionName:  "game",
-					Description: "which game to show servers for",
-					Required:    true,
-					Choices:     choices,
+					OptionName:   "game",
+					Description:  "which game to show servers for",
+					Required:     true,
+					Autocomplete: true,
+				},
+				&discord.StringOption{
+					OptionName:  "sort",
+					Description: "order to list the servers in, defaults to most players first",
+					Required:    false,
+					Choices:     sorting.Choices,
 				},
 				&discord.BooleanOption{
 					OptionName:  "mobile",
 					Description: "format serverlist for mobile devices",
 					Required:    false,
 				},
+				&discord.BooleanOption{
+					OptionName:  "colors",
+					Description: "show hostnames in their in-game colors, only visible on desktop",
+					Required:    false,
+				},
+				&discord.StringOption{
+					OptionName:  "filter",
+					Description: "filter expression, e.g. map:crash gametype:tdm players>=4 -hostname:test",
+					Required:    false,
+				},
 				&discord.BooleanOption{
 					OptionName:  "full",
 					Description: "show full servers",
@@ -64,43 +80,59 @@ func CreateCommand(srv *server.Server) (cmd command.SlashCommand, err error) {
 	return
 }
 
-func (sh *serverlistHandler) sendMessage(event *gateway.InteractionCreateEvent, options map[string]discord.CommandInteractionOption) {
-	if servers, present := sh.server.GameServers[options["game"].String()]; present {
-		if len(servers) == 0 {
-			_, mErr := sh.session.SendMessage(event.ChannelID, "no servers found for the specified game.")
-			if mErr != nil {
-				log.Printf("error occured sending message")
-			}
-			return
+func (sh *serverlistHandler) serverList(options map[string]discord.CommandInteractionOption) *api.InteractionResponseData {
+	servers, present := sh.server.Servers(options["game"].String())
+	if !present {
+		return &api.InteractionResponseData{
+			Content: option.NewNullableString("couldn't find specified game in cache"),
+		}
+	}
+
+	if len(servers) == 0 {
+		return &api.InteractionResponseData{
+			Content: option.NewNullableString("no servers found for the specified game."),
 		}
+	}
 
-		servers := filter(servers, options)
+	servers = applyOptions(servers, options)
 
-		desc := sh.formatter.DesktopList(servers)
-		if val, present := options["mobile"]; present {
-			mobile, err := val.BoolValue()
-			if err != nil {
-				mobile = false
-			}
-			if mobile {
-				desc = sh.formatter.MobileList(servers)
+	if val, present := options["filter"]; present {
+		mapnames, gametypes := sh.server.Aliases()
+		f, err := filter.Parse(val.String(), mapnames, gametypes)
+		if err != nil {
+			return &api.InteractionResponseData{
+				Content: option.NewNullableString(fmt.Sprintf("invalid filter: %v", err)),
 			}
 		}
-		for _, m := range desc {
-			_, mErr := sh.session.SendMessage(event.ChannelID, m)
-			if mErr != nil {
-				log.Printf("error occured sending message")
-			}
+		servers = f.Apply(servers)
+	}
+	sorting.Sort(servers, sorting.OrderOption(options))
+
+	formatter := sh.formatter
+	if val, present := options["colors"]; present {
+		colored, err := val.BoolValue()
+		if err != nil {
+			colored = false
+		}
+		formatter = formatter.WithColors(colored)
+	}
+
+	desc := formatter.DesktopList(servers)
+	if val, present := options["mobile"]; present {
+		mobile, err := val.BoolValue()
+		if err != nil {
+			mobile = false
 		}
-	} else {
-		_, mErr := sh.session.SendMessage(event.ChannelID, "couldn't find specified game in cache")
-		if mErr != nil {
-			log.Printf("error occured sending message")
+		if mobile {
+			desc = formatter.MobileList(servers)
 		}
 	}
+	desc = formatter.WithFooter(desc, formatter.Excluded(sh.server.Excluded(options["game"].String())))
+
+	return sh.server.PaginatedResponse(commandName, desc)
 }
 
-func filter(list []server.GameServer, options map[string]discord.CommandInteractionOption) []server.GameServer {
+func applyOptions(list []server.GameServer, options map[string]discord.CommandInteractionOption) []server.GameServer {
 	full := true
 	empty := true
 	var err error
@@ -122,17 +154,9 @@ func filter(list []server.GameServer, options map[string]discord.CommandInteract
 	var ret []server.GameServer
 
 	for _, s := range list {
-		c, cerr := strconv.Atoi(s["clients"])
-		b, berr := strconv.Atoi(s["bots"])
-		m, merr := strconv.Atoi(s["sv_maxclients"])
-		if cerr != nil || berr != nil || merr != nil {
-			continue
-		}
-
-		// basic sanity checks
-		if b > c || (c > 18 || c < 0) || (b > 18 || b < 0) || (m > 18 || m < 0) {
-			continue
-		}
+		// the cache only holds servers within the limits of their game, so the counts are valid
+		c, _ := strconv.Atoi(s["clients"])
+		m, _ := strconv.Atoi(s["sv_maxclients"])
 
 		if !full && c == m {
 			continue
@@ -153,10 +177,27 @@ func (sh *serverlistHandler) handleInteraction(
 ) (
 	response *api.InteractionResponseData, err error,
 ) {
-	go sh.sendMessage(event, options)
+	response = sh.serverList(options)
+	return
+}
+
+func (sh *serverlistHandler) handleComponent(
+	event *gateway.InteractionCreateEvent, data discord.ComponentInteraction, args []string,
+) (
+	response *api.InteractionResponse, err error,
+) {
+	return sh.server.PageResponse(commandName, args)
+}
 
-	response = &api.InteractionResponseData{
-		Content: option.NewNullableString("sending server list, please wait..."),
+func (sh *serverlistHandler) handleAutocomplete(
+	event *gateway.InteractionCreateEvent,
+	focused discord.AutocompleteOption,
+	options map[string]discord.AutocompleteOption,
+) (
+	choices []api.AutocompleteChoice, err error,
+) {
+	if focused.Name == "game" {
+		choices = sh.server.GameChoices(focused.Value)
 	}
 	return
 }
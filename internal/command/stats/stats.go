@@ -21,25 +21,20 @@ type statsHandler struct {
 
 // CreateCommand creates a SlashCommand which handles /stats
 func CreateCommand(srv *server.Server) (cmd command.SlashCommand, err error) {
-	sh := statsHandler{session: srv.Session, server: srv, formatter: stringformat.New(srv.Mapnames, srv.Gametypes)}
-
-	choices := []discord.StringChoice{}
-	for _, master := range srv.MasterServers {
-		gameId := master.GameId
-		choices = append(choices, discord.StringChoice{Name: gameId, Value: gameId})
-	}
+	sh := statsHandler{session: srv.Session, server: srv, formatter: stringformat.New(srv.Aliases)}
 
 	cmd = command.SlashCommand{
-		HandleInteraction: sh.handleInteraction,
+		HandleInteraction:  sh.handleInteraction,
+		HandleAutocomplete: sh.handleAutocomplete,
 		CommandData: api.CreateCommandData{
 			Name:        "stats",
 			Description: "lists stats for the given game",
 			Options: []discord.CommandOption{
 				&discord.StringOption{
-					OptionName:  "game",
-					Description: "which game to list stats for",
-					Required:    true,
-					Choices:     choices,
+					OptionName:   "game",
+					Description:  "which game to list stats for",
+					Required:     true,
+					Autocomplete: true,
 				},
 			},
 		},
@@ -54,25 +49,29 @@ func (sh *statsHandler) handleInteraction(
 	response *api.InteractionResponseData, err error,
 ) {
 	var r string
-	if servers, present := sh.server.GameServers[options["game"].String()]; present {
-		var totalservers, totalplayers, totalbots int
+	if servers, present := sh.server.Servers(options["game"].String()); present {
+		var totalservers, totalplayers, totalbots, stale int
 		for _, s := range servers {
-			c, cerr := strconv.Atoi(s["clients"])
-			b, berr := strconv.Atoi(s["bots"])
-			if cerr != nil || berr != nil {
-				continue
-			}
-
-			// basic sanity checks
-			if b > c || (c > 18 || c < 0) || (b > 18 || b < 0) {
+			// servers kept from an earlier refresh may have emptied or gone down since
+			if server.IsStale(s) {
+				stale++
 				continue
 			}
+			// the cache only holds servers within the limits of their game, so the counts are valid
+			c, _ := strconv.Atoi(s["clients"])
+			b, _ := strconv.Atoi(s["bots"])
 
 			totalplayers += c - b
 			totalbots += b
 			totalservers += 1
 		}
 		r = sh.formatter.Stats(totalservers, totalplayers, totalbots)
+		if note := sh.formatter.Stale(stale); note != "" {
+			r += "\n" + note
+		}
+		if excluded := sh.formatter.Excluded(sh.server.Excluded(options["game"].String())); excluded != "" {
+			r += "\n" + excluded
+		}
 	} else {
 		r = "couldn't find specified game in cache"
 	}
@@ -82,3 +81,16 @@ func (sh *statsHandler) handleInteraction(
 	}
 	return
 }
+
+func (sh *statsHandler) handleAutocomplete(
+	event *gateway.InteractionCreateEvent,
+	focused discord.AutocompleteOption,
+	options map[string]discord.AutocompleteOption,
+) (
+	choices []api.AutocompleteChoice, err error,
+) {
+	if focused.Name == "game" {
+		choices = sh.server.GameChoices(focused.Value)
+	}
+	return
+}
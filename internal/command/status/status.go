@@ -0,0 +1,44 @@
+package status
+
+import (
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/session"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+	"github.com/trondhumbor/pigeon/internal/command"
+	"github.com/trondhumbor/pigeon/internal/server"
+	"github.com/trondhumbor/pigeon/internal/stringformat"
+)
+
+type statusHandler struct {
+	session   *session.Session
+	server    *server.Server
+	formatter stringformat.Formatter
+}
+
+// CreateCommand creates a SlashCommand which handles /status
+func CreateCommand(srv *server.Server) (cmd command.SlashCommand, err error) {
+	sh := statusHandler{session: srv.Session, server: srv, formatter: stringformat.New(srv.Aliases)}
+
+	cmd = command.SlashCommand{
+		HandleInteraction: sh.handleInteraction,
+		CommandData: api.CreateCommandData{
+			Name:        "status",
+			Description: "shows the uptime of the bot and the state of each master server",
+		},
+	}
+
+	return
+}
+
+func (sh *statusHandler) handleInteraction(
+	event *gateway.InteractionCreateEvent, options map[string]discord.CommandInteractionOption,
+) (
+	response *api.InteractionResponseData, err error,
+) {
+	response = &api.InteractionResponseData{
+		Content: option.NewNullableString(sh.formatter.Health(sh.server.Health())),
+	}
+	return
+}
@@ -0,0 +1,307 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A filter expression is a list of whitespace separated terms which must all match a server, e.g.
+//
+//	map:crash gametype:tdm players>=4 -hostname:test
+//
+// A term is either a bare word, which matches servers whose hostname contains it, or a field
+// followed by an operator and a value. Prefixing a term with - negates it, and values containing
+// whitespace can be quoted. Words whose prefix isn't a known field, such as http://example.com,
+// are bare words too.
+//
+// Text fields support : (contains), = and != (equals), all case-insensitive. Numeric fields support
+// : and = (equals), !=, <, <=, > and >=. Map and gametype values also match the configured aliases.
+
+type kind int
+
+const (
+	text kind = iota
+	numeric
+)
+
+type field struct {
+	kind kind
+	// key is the server info key holding the value of text fields
+	key string
+	// value computes the value of numeric fields
+	value func(map[string]string) (int, bool)
+}
+
+func infoInt(key string) func(map[string]string) (int, bool) {
+	return func(s map[string]string) (int, bool) {
+		i, err := strconv.Atoi(s[key])
+		return i, err == nil
+	}
+}
+
+// optionalInt is like infoInt, but a missing key counts as zero. Not every server reports bots.
+func optionalInt(key string) func(map[string]string) (int, bool) {
+	return func(s map[string]string) (int, bool) {
+		if _, present := s[key]; !present {
+			return 0, true
+		}
+		return infoInt(key)(s)
+	}
+}
+
+func difference(a, b func(map[string]string) (int, bool)) func(map[string]string) (int, bool) {
+	return func(s map[string]string) (int, bool) {
+		x, xok := a(s)
+		y, yok := b(s)
+		return x - y, xok && yok
+	}
+}
+
+var fields = map[string]field{
+	"hostname":   {kind: text, key: "hostname"},
+	"host":       {kind: text, key: "hostname"},
+	"map":        {kind: text, key: "mapname"},
+	"gametype":   {kind: text, key: "gametype"},
+	"gt":         {kind: text, key: "gametype"},
+	"game":       {kind: text, key: "gamename"},
+	"ip":         {kind: text, key: "ip"},
+	"players":    {kind: numeric, value: difference(infoInt("clients"), optionalInt("bots"))},
+	"clients":    {kind: numeric, value: infoInt("clients")},
+	"bots":       {kind: numeric, value: optionalInt("bots")},
+	"maxclients": {kind: numeric, value: infoInt("sv_maxclients")},
+	"free":       {kind: numeric, value: difference(infoInt("sv_maxclients"), infoInt("clients"))},
+	"ping":       {kind: numeric, value: infoInt("ping")},
+}
+
+// operators ordered so that two-character operators are tried first
+var operators = []string{">=", "<=", "!=", ":", "=", ">", "<"}
+
+type term struct {
+	negated  bool
+	field    field
+	operator string
+	value    string
+	number   int
+}
+
+// Filter is a parsed filter expression
+type Filter struct {
+	terms     []term
+	mapnames  map[string]string
+	gametypes map[string]string
+}
+
+// Parse parses a filter expression. mapnames and gametypes are the configured aliases, which
+// map and gametype terms match in addition to the raw server values.
+func Parse(expr string, mapnames, gametypes map[string]string) (f Filter, err error) {
+	f = Filter{mapnames: mapnames, gametypes: gametypes}
+
+	p := parser{input: []rune(expr)}
+	for {
+		p.skipSpace()
+		if p.done() {
+			return
+		}
+
+		t, err := p.term()
+		if err != nil {
+			return Filter{}, err
+		}
+		f.terms = append(f.terms, t)
+	}
+}
+
+// Empty reports whether the filter has no terms and thus matches every server
+func (f Filter) Empty() bool {
+	return len(f.terms) == 0
+}
+
+// Match reports whether the server matches every term of the filter
+func (f Filter) Match(s map[string]string) bool {
+	for _, t := range f.terms {
+		if f.matchTerm(t, s) == t.negated {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the servers matching the filter
+func (f Filter) Apply(servers []map[string]string) []map[string]string {
+	var ret []map[string]string
+	for _, s := range servers {
+		if f.Match(s) {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func (f Filter) matchTerm(t term, s map[string]string) bool {
+	if t.field.kind == numeric {
+		v, ok := t.field.value(s)
+		if !ok {
+			return false
+		}
+		return compare(v, t.operator, t.number)
+	}
+
+	candidates := []string{s[t.field.key]}
+	switch t.field.key {
+	case "mapname":
+		if alias, present := f.mapnames[s["mapname"]]; present {
+			candidates = append(candidates, alias)
+		}
+	case "gametype":
+		if alias, present := f.gametypes[s["gametype"]]; present {
+			candidates = append(candidates, alias)
+		}
+	}
+
+	want := strings.ToLower(t.value)
+	for _, c := range candidates {
+		c = strings.ToLower(c)
+		switch t.operator {
+		case ":":
+			if strings.Contains(c, want) {
+				return true
+			}
+		case "=":
+			if c == want {
+				return true
+			}
+		case "!=":
+			if c == want {
+				return false
+			}
+		}
+	}
+	return t.operator == "!="
+}
+
+func compare(v int, operator string, want int) bool {
+	switch operator {
+	case ":", "=":
+		return v == want
+	case "!=":
+		return v != want
+	case ">":
+		return v > want
+	case ">=":
+		return v >= want
+	case "<":
+		return v < want
+	case "<=":
+		return v <= want
+	}
+	return false
+}
+
+type parser struct {
+	input []rune
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) skipSpace() {
+	for !p.done() && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *parser) term() (t term, err error) {
+	if p.input[p.pos] == '-' && p.pos+1 < len(p.input) && !unicode.IsSpace(p.input[p.pos+1]) {
+		t.negated = true
+		p.pos++
+	}
+
+	start := p.pos
+	for !p.done() && unicode.IsLetter(p.input[p.pos]) {
+		p.pos++
+	}
+	name := strings.ToLower(string(p.input[start:p.pos]))
+
+	operator := ""
+	for _, op := range operators {
+		if strings.HasPrefix(string(p.input[p.pos:]), op) {
+			operator = op
+			break
+		}
+	}
+
+	f, known := fields[name]
+	if !known || operator == "" {
+		// not a field, so the whole term is a bare hostname word such as "CTF: Duel"
+		p.pos = start
+		t.field = fields["hostname"]
+		t.operator = ":"
+		t.value, err = p.value()
+		return
+	}
+
+	t.field = f
+	t.operator = operator
+	p.pos += len([]rune(operator))
+
+	t.value, err = p.value()
+	if err != nil {
+		return
+	}
+	if t.value == "" {
+		return t, fmt.Errorf("missing value for filter field %q", name)
+	}
+
+	if f.kind == numeric {
+		t.number, err = strconv.Atoi(t.value)
+		if err != nil {
+			return t, fmt.Errorf("filter field %q needs a number, got %q", name, t.value)
+		}
+	} else if operator != ":" && operator != "=" && operator != "!=" {
+		return t, fmt.Errorf("filter field %q can't be compared with %s", name, operator)
+	}
+
+	return
+}
+
+// value reads a quoted value, or an unquoted one up to the next whitespace
+func (p *parser) value() (string, error) {
+	if p.done() || p.input[p.pos] != '"' {
+		start := p.pos
+		for !p.done() && !unicode.IsSpace(p.input[p.pos]) {
+			p.pos++
+		}
+		return string(p.input[start:p.pos]), nil
+	}
+
+	p.pos++ // opening quote
+	var b strings.Builder
+	for !p.done() {
+		r := p.input[p.pos]
+		p.pos++
+		switch {
+		case r == '\\' && !p.done():
+			b.WriteRune(p.input[p.pos])
+			p.pos++
+		case r == '"':
+			return b.String(), nil
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return "", fmt.Errorf("unterminated quote in filter")
+}
+
+// Quote returns s as a single term matching hostnames containing s, quoting it if necessary
+func Quote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"\\:=<>!") && !strings.HasPrefix(s, "-") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,132 @@
+package filter
+
+import "testing"
+
+var (
+	testMapnames  = map[string]string{"q3dm17": "The Longest Yard"}
+	testGametypes = map[string]string{"4": "CTF"}
+)
+
+var (
+	duel = map[string]string{
+		"hostname":      "CTF: Duel Arena",
+		"mapname":       "q3dm17",
+		"gametype":      "1",
+		"gamename":      "baseq3",
+		"ip":            "10.0.0.1:27960",
+		"clients":       "6",
+		"bots":          "2",
+		"sv_maxclients": "8",
+		"ping":          "40",
+	}
+	ctf = map[string]string{
+		"hostname":      "Friday night ctf",
+		"mapname":       "q3ctf1",
+		"gametype":      "4",
+		"gamename":      "baseq3",
+		"ip":            "10.0.0.2:27960",
+		"clients":       "12",
+		"sv_maxclients": "16",
+		"ping":          "90",
+	}
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		expr string
+		duel bool
+		ctf  bool
+	}{
+		{"", true, true},
+		{"duel", true, false},
+		{"FRIDAY", false, true},
+		{"ctf", true, true},
+		{`"night ctf"`, false, true},
+		{`"CTF: Duel"`, true, false},
+		{`hostname:"duel arena"`, true, false},
+		{`"say \"hi\""`, false, false},
+		{"CTF: Duel", true, false},
+		{"http://example.com", false, false},
+		{"-duel", false, true},
+		{`-"night ctf"`, true, false},
+		{"- duel", false, false},
+		{"map:dm17", true, false},
+		{"map:longest", true, false},
+		{"map=q3dm17", true, false},
+		{`map="the longest yard"`, true, false},
+		{"map!=q3dm17", false, true},
+		{`map!="the longest yard"`, false, true},
+		{"gt=ctf", false, true},
+		{"gt!=ctf", true, false},
+		{"gametype!=4", true, false},
+		{"game=baseq3 ip:10.0.0.2", false, true},
+		{"players>=4", true, true},
+		{"players>4", false, true},
+		{"players=4", true, false},
+		{"players:12", false, true},
+		{"clients<10", true, false},
+		{"clients<=12", true, true},
+		{"free!=4", true, false},
+		{"maxclients>8", false, true},
+		{"ping<50", true, false},
+		{"bots>=0", true, true},
+		{"bots=0", false, true},
+		{"-bots>0", false, true},
+		{"map:q3 players>4 -ping>100", false, true},
+	}
+
+	for _, tt := range tests {
+		f, err := Parse(tt.expr, testMapnames, testGametypes)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", tt.expr, err)
+			continue
+		}
+		if got := f.Match(duel); got != tt.duel {
+			t.Errorf("Parse(%q).Match(duel) = %v, want %v", tt.expr, got, tt.duel)
+		}
+		if got := f.Match(ctf); got != tt.ctf {
+			t.Errorf("Parse(%q).Match(ctf) = %v, want %v", tt.expr, got, tt.ctf)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		`"unterminated`,
+		`map:"unterminated`,
+		"map:",
+		`map:""`,
+		"players>many",
+		"ping=",
+		"map>q3dm17",
+		"hostname<=a",
+	}
+
+	for _, expr := range tests {
+		if _, err := Parse(expr, nil, nil); err == nil {
+			t.Errorf("Parse(%q) returned no error", expr)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []string{
+		"duel",
+		"CTF: Duel",
+		"-minus",
+		`back\slash "quoted"`,
+		"players>=4",
+		"",
+	}
+
+	for _, hostname := range tests {
+		f, err := Parse(Quote(hostname), nil, nil)
+		if err != nil {
+			t.Errorf("Parse(Quote(%q)) returned error: %v", hostname, err)
+			continue
+		}
+		if len(f.terms) != 1 || f.terms[0].value != hostname || f.terms[0].negated {
+			t.Errorf("Parse(Quote(%q)) = %+v, want a single hostname term", hostname, f.terms)
+		}
+	}
+}
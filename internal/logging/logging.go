@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Config configures the level, format and output of the logs
+type Config struct {
+	// Level is one of debug, info, warn or error, defaulting to info
+	Level string `json:"level,omitempty"`
+	// Format is either logfmt or json, defaulting to logfmt
+	Format string `json:"format,omitempty"`
+	// Output is stderr, stdout or the path of a file to append to, defaulting to stderr
+	Output string `json:"output,omitempty"`
+}
+
+// Merge returns the config with the fields set in override replacing its own
+func (c Config) Merge(override Config) Config {
+	if override.Level != "" {
+		c.Level = override.Level
+	}
+	if override.Format != "" {
+		c.Format = override.Format
+	}
+	if override.Output != "" {
+		c.Output = override.Output
+	}
+	return c
+}
+
+// output is the file the current default logger writes to, if any
+var output *os.File
+
+// Setup replaces the default logger with one configured by cfg
+func Setup(cfg Config) error {
+	var level slog.Level
+	switch strings.ToLower(cfg.Level) {
+	case "debug":
+		level = slog.LevelDebug
+	case "", "info":
+		level = slog.LevelInfo
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		return fmt.Errorf("unknown log level %q", cfg.Level)
+	}
+
+	var w io.Writer
+	var file *os.File
+	switch cfg.Output {
+	case "", "stderr":
+		w = os.Stderr
+	case "stdout":
+		w = os.Stdout
+	default:
+		var err error
+		file, err = os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("opening log file: %v", err)
+		}
+		w = file
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "logfmt", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		if file != nil {
+			file.Close()
+		}
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	if output != nil {
+		output.Close()
+	}
+	output = file
+	return nil
+}
+
+// Close closes the log file, if logging to one
+func Close() {
+	if output != nil {
+		output.Close()
+		output = nil
+	}
+}
@@ -0,0 +1,134 @@
+package pagination
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/trondhumbor/pigeon/internal/command"
+)
+
+// customIDAction marks the custom IDs of the pagination buttons within the owning command's namespace
+const customIDAction = "page"
+
+type entry struct {
+	pages   []string
+	expires time.Time
+}
+
+// Store keeps the pages of paginated messages in memory until they expire
+type Store struct {
+	ttl     time.Duration
+	entries map[string]*entry
+	mutex   sync.Mutex
+}
+
+// New creates a store where each paginated message expires after ttl without interaction
+func New(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, entries: make(map[string]*entry)}
+}
+
+// Add stores the pages of a new message and returns the id identifying it
+func (s *Store) Add(pages []string) string {
+	id := newID()
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// expired entries are pruned whenever a new message is added
+	for k, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+
+	s.entries[id] = &entry{pages: pages, expires: now.Add(s.ttl)}
+	return id
+}
+
+// Page returns page n of the message with the given id, clamped to the available pages,
+// together with the clamped page number and total page count. ok is false if the message
+// is unknown or has expired.
+func (s *Store) Page(id string, n int) (page string, current int, total int, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, present := s.entries[id]
+	if !present || time.Now().After(e.expires) {
+		delete(s.entries, id)
+		return "", 0, 0, false
+	}
+
+	// every interaction keeps the message alive for another ttl
+	e.expires = time.Now().Add(s.ttl)
+
+	total = len(e.pages)
+	if n >= total {
+		n = total - 1
+	}
+	if n < 0 {
+		n = 0
+	}
+	return e.pages[n], n, total, true
+}
+
+// Components returns the Previous/Next buttons for page current of the message with the given id,
+// or nil if the message only has a single page. Clicks on the buttons are routed to the command
+// with the given name.
+func Components(commandName, id string, current, total int) *discord.ContainerComponents {
+	if total <= 1 {
+		return nil
+	}
+
+	return discord.ComponentsPtr(
+		&discord.ActionRowComponent{
+			&discord.ButtonComponent{
+				Style:    discord.SecondaryButtonStyle(),
+				CustomID: customID(commandName, id, current-1),
+				Label:    "Previous",
+				Disabled: current <= 0,
+			},
+			&discord.ButtonComponent{
+				Style:    discord.SecondaryButtonStyle(),
+				CustomID: customID(commandName, id, current),
+				Label:    fmt.Sprintf("%d / %d", current+1, total),
+				Disabled: true,
+			},
+			&discord.ButtonComponent{
+				Style:    discord.SecondaryButtonStyle(),
+				CustomID: customID(commandName, id, current+1),
+				Label:    "Next",
+				Disabled: current >= total-1,
+			},
+		},
+	)
+}
+
+// ParseArgs extracts the message id and requested page from the custom ID arguments of a
+// pagination button
+func ParseArgs(args []string) (id string, page int, ok bool) {
+	if len(args) != 3 || args[0] != customIDAction {
+		return "", 0, false
+	}
+
+	page, err := strconv.Atoi(args[2])
+	if err != nil {
+		return "", 0, false
+	}
+
+	return args[1], page, true
+}
+
+func customID(commandName, id string, page int) discord.ComponentID {
+	return command.CustomID(commandName, customIDAction, id, strconv.Itoa(page))
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
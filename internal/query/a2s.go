@@ -0,0 +1,345 @@
+package query
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// The request and response types of the Source engine query protocol, A2S
+const (
+	a2sInfo           = 'T'
+	a2sInfoResponse   = 'I'
+	a2sPlayer         = 'U'
+	a2sPlayerResponse = 'D'
+	a2sRules          = 'V'
+	a2sRulesResponse  = 'E'
+	a2sChallenge      = 'A'
+)
+
+const (
+	// a2sMaxPacketSize is larger than any packet a Source server sends, which is about 1400 bytes
+	a2sMaxPacketSize = 4096
+	// a2sMaxChallenges is how many challenges in a row are answered before giving up on a server
+	a2sMaxChallenges = 3
+	// a2sCompressed marks the id of a split response whose payload is bzip2 compressed
+	a2sCompressed = 0x80000000
+	// a2sMaxDecompressedSize bounds the size a compressed response may claim, far above that of any
+	// real response, so a server can't make the bot decompress a bzip2 bomb
+	a2sMaxDecompressedSize = 64 * 1024
+	// theShipAppID is the only game with extra fields in its A2S_INFO response
+	theShipAppID = 2400
+)
+
+var (
+	// a2sSplitHeader starts every packet of a response split over several packets
+	a2sSplitHeader = []byte{0xFE, 0xFF, 0xFF, 0xFF}
+	// a2sInfoPayload is the payload of an A2S_INFO request, before the challenge
+	a2sInfoPayload = []byte("Source Engine Query\x00")
+	// a2sNoChallenge asks the server for a challenge in A2S_PLAYER and A2S_RULES requests
+	a2sNoChallenge = []byte{0xFF, 0xFF, 0xFF, 0xFF}
+)
+
+// sourceDriver speaks A2S, the query protocol of Source and GoldSource engine servers
+type sourceDriver struct{}
+
+// ListServers lists servers from a Steam master server. Without a filter in the options, the
+// servers of the game folder named by the game id are listed.
+func (sourceDriver) ListServers(ctx context.Context, master string, opts ListOptions) ([]string, error) {
+	filter := opts.Filter
+	if filter == "" {
+		filter = `\gamedir\` + opts.GameId
+	}
+	return GetSteamMasterResponse(ctx, master, opts.Region, filter)
+}
+
+func (sourceDriver) Info(ctx context.Context, address string) (map[string]string, error) {
+	return GetA2SInfo(ctx, address)
+}
+
+func (sourceDriver) Players(ctx context.Context, address string) ([]Player, error) {
+	return GetA2SPlayers(ctx, address)
+}
+
+// Rules returns the server's rules, which are its public console variables
+func (sourceDriver) Rules(ctx context.Context, address string) (map[string]string, error) {
+	return GetA2SRules(ctx, address)
+}
+
+// GetA2SInfo queries a server with A2S_INFO, and normalizes the response to the keys of a Quake 3
+// infostring. Source counts bots as players, as Quake 3 counts them as clients.
+func GetA2SInfo(ctx context.Context, address string) (map[string]string, error) {
+	payload, ping, err := a2sRequest(ctx, address, a2sInfoResponse, func(challenge []byte) []byte {
+		return append(append([]byte{a2sInfo}, a2sInfoPayload...), challenge...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := packetReader{b: payload}
+	protocol := r.byte()
+	name := r.string()
+	mapname := r.string()
+	folder := r.string()
+	game := r.string()
+	appID := r.short()
+	players := r.byte()
+	maxPlayers := r.byte()
+	bots := r.byte()
+	serverType := r.byte()
+	environment := r.byte()
+	visibility := r.byte()
+	vac := r.byte()
+	if appID == theShipAppID {
+		r.take(3) // mode, witnesses and duration
+	}
+	version := r.string()
+	if r.err != nil {
+		return nil, fmt.Errorf("malformed A2S_INFO response: %v", r.err)
+	}
+
+	info := map[string]string{
+		"hostname":      name,
+		"mapname":       mapname,
+		"gamename":      folder,
+		"gametype":      game,
+		"clients":       strconv.Itoa(int(players)),
+		"sv_maxclients": strconv.Itoa(int(maxPlayers)),
+		"bots":          strconv.Itoa(int(bots)),
+		"protocol":      strconv.Itoa(int(protocol)),
+		"appid":         strconv.Itoa(int(appID)),
+		"version":       version,
+		"servertype":    string(rune(serverType)),
+		"environment":   string(rune(environment)),
+		"g_needpass":    strconv.Itoa(int(visibility)),
+		"vac":           strconv.Itoa(int(vac)),
+		"ip":            address,
+		"ping":          strconv.FormatInt(ping.Milliseconds(), 10),
+	}
+
+	// the extra data is optional, and flags which fields follow
+	if len(r.rest()) > 0 {
+		edf := r.byte()
+		if edf&0x80 != 0 {
+			info["port"] = strconv.Itoa(int(r.short()))
+		}
+		if edf&0x10 != 0 {
+			info["steamid"] = strconv.FormatUint(r.longlong(), 10)
+		}
+		if edf&0x40 != 0 {
+			info["tvport"] = strconv.Itoa(int(r.short()))
+			info["tvname"] = r.string()
+		}
+		if edf&0x20 != 0 {
+			info["keywords"] = r.string()
+		}
+		if edf&0x01 != 0 {
+			// the lower 24 bits are the full app id, which the short above can't always hold
+			info["appid"] = strconv.FormatUint(r.longlong()&0xFFFFFF, 10)
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("malformed A2S_INFO extra data: %v", r.err)
+		}
+	}
+
+	return info, nil
+}
+
+// GetA2SPlayers queries a server with A2S_PLAYER. A2S doesn't report the ping of players.
+func GetA2SPlayers(ctx context.Context, address string) ([]Player, error) {
+	payload, _, err := a2sRequest(ctx, address, a2sPlayerResponse, func(challenge []byte) []byte {
+		return append([]byte{a2sPlayer}, orNoChallenge(challenge)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := packetReader{b: payload}
+	count := int(r.byte())
+	players := []Player{}
+	for i := 0; i < count && r.err == nil; i++ {
+		r.byte() // index, which is always 0
+		name := r.string()
+		score := int32(r.long())
+		r.float() // seconds connected
+		players = append(players, Player{Name: name, Score: int(score)})
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("malformed A2S_PLAYER response: %v", r.err)
+	}
+
+	return players, nil
+}
+
+// GetA2SRules queries a server with A2S_RULES
+func GetA2SRules(ctx context.Context, address string) (map[string]string, error) {
+	payload, _, err := a2sRequest(ctx, address, a2sRulesResponse, func(challenge []byte) []byte {
+		return append([]byte{a2sRules}, orNoChallenge(challenge)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := packetReader{b: payload}
+	count := int(r.short())
+	rules := map[string]string{}
+	for i := 0; i < count; i++ {
+		name := r.string()
+		value := r.string()
+		if r.err != nil {
+			// some servers cut long rule lists short, so keep the rules read until then
+			break
+		}
+		rules[name] = value
+	}
+	if r.err != nil && len(rules) == 0 {
+		return nil, fmt.Errorf("malformed A2S_RULES response: %v", r.err)
+	}
+
+	return rules, nil
+}
+
+func orNoChallenge(challenge []byte) []byte {
+	if challenge == nil {
+		return a2sNoChallenge
+	}
+	return challenge
+}
+
+// a2sRequest sends the request built by request, answering any challenge the server sends with
+// the request built for that challenge. It returns the payload of the response following its
+// type, and the round trip time of the request answered.
+func a2sRequest(
+	ctx context.Context, address string, expect byte, request func(challenge []byte) []byte,
+) ([]byte, time.Duration, error) {
+	conn, closeConn, err := dial(ctx, address)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer closeConn()
+
+	var challenge []byte
+	for i := 0; i < a2sMaxChallenges; i++ {
+		start := time.Now()
+		if _, err := conn.Write(append(append([]byte(nil), oobHeader...), request(challenge)...)); err != nil {
+			return nil, 0, err
+		}
+
+		response, err := readA2SResponse(conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, ctx.Err()
+			}
+			return nil, 0, err
+		}
+		ping := time.Since(start)
+
+		if len(response) == 0 {
+			return nil, 0, fmt.Errorf("empty A2S response")
+		}
+		switch response[0] {
+		case a2sChallenge:
+			if len(response) < 5 {
+				return nil, 0, fmt.Errorf("malformed A2S challenge")
+			}
+			challenge = append([]byte(nil), response[1:5]...)
+		case expect:
+			return response[1:], ping, nil
+		default:
+			return nil, 0, fmt.Errorf("unexpected A2S response type 0x%02x", response[0])
+		}
+	}
+	return nil, 0, fmt.Errorf("server answered %d challenges in a row with another one", a2sMaxChallenges)
+}
+
+// readA2SResponse reads a response, reassembling it if it is split over several packets, and
+// returns it without its header
+func readA2SResponse(conn net.Conn) ([]byte, error) {
+	buf := make([]byte, a2sMaxPacketSize)
+	var parts [][]byte
+	var id uint32
+	received := 0
+
+	for parts == nil || received < len(parts) {
+		read, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		packet := buf[:read]
+
+		if bytes.HasPrefix(packet, oobHeader) {
+			if parts == nil {
+				return append([]byte(nil), packet[len(oobHeader):]...), nil
+			}
+			continue // a stray reply to an earlier request
+		}
+		if !bytes.HasPrefix(packet, a2sSplitHeader) {
+			return nil, fmt.Errorf("malformed A2S packet header")
+		}
+
+		// only the split packet format of Source engine servers is supported, not the one of
+		// GoldSource, nor the one without the size field used by some early Source games
+		r := packetReader{b: packet[len(a2sSplitHeader):]}
+		packetID := r.long()
+		total := int(r.byte())
+		number := int(r.byte())
+		r.short() // size of the packets
+		if r.err != nil || total == 0 || number >= total {
+			return nil, fmt.Errorf("malformed A2S split packet")
+		}
+
+		if parts == nil {
+			id = packetID
+			parts = make([][]byte, total)
+		}
+		if packetID != id || total != len(parts) {
+			continue // part of another response
+		}
+		if parts[number] == nil {
+			parts[number] = append([]byte(nil), r.rest()...)
+			received++
+		}
+	}
+
+	data := bytes.Join(parts, nil)
+	if id&a2sCompressed != 0 {
+		var err error
+		if data, err = decompressA2S(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if !bytes.HasPrefix(data, oobHeader) {
+		return nil, fmt.Errorf("malformed A2S split response")
+	}
+	return data[len(oobHeader):], nil
+}
+
+// decompressA2S decompresses the payload of a compressed split response, which starts with its
+// decompressed size and CRC32 checksum
+func decompressA2S(data []byte) ([]byte, error) {
+	r := packetReader{b: data}
+	size := r.long()
+	checksum := r.long()
+	if r.err != nil {
+		return nil, fmt.Errorf("malformed compressed A2S response")
+	}
+	if size > a2sMaxDecompressedSize {
+		return nil, fmt.Errorf("compressed A2S response claims %d bytes, more than the %d allowed", size, a2sMaxDecompressedSize)
+	}
+
+	decompressed, err := io.ReadAll(io.LimitReader(bzip2.NewReader(bytes.NewReader(r.rest())), int64(size)+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing A2S response: %v", err)
+	}
+	if len(decompressed) != int(size) || crc32.ChecksumIEEE(decompressed) != checksum {
+		return nil, fmt.Errorf("compressed A2S response doesn't match its size or checksum")
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,272 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+)
+
+// rulesResponse is an A2S_RULES response, and rulesBzip2 the same compressed with bzip2
+var (
+	rulesResponse = []byte("\xff\xff\xff\xffE\x02\x00sv_cheats\x000\x00mp_timelimit\x0030\x00")
+	rulesCRC      = uint32(0x5510eaf0)
+	rulesBzip2    = []byte("\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\x5b\x42\x68\x3d\x00\x00\x11\xcf\x80\xd0" +
+		"\x00\x48\x00\x02\x00\x00\x00\xaa\x66\x4d\x00\x00\x00\xa0\x00\x22\x21\xa6\x80\x69\xa7\xea\x85\x34" +
+		"\xc8\xc4\xc4\xc4\xec\x0c\xd3\xbd\xaf\x34\x07\xdf\x48\x71\x6c\x26\x95\xa8\xb8\x02\x4d\xf1\x77\x24" +
+		"\x53\x85\x09\x05\xb4\x26\x83\xd0")
+)
+
+// a2sSplit builds a packet of a split response in the Source engine format
+func a2sSplit(id uint32, total, number byte, payload []byte) []byte {
+	packet := append([]byte(nil), a2sSplitHeader...)
+	packet = binary.LittleEndian.AppendUint32(packet, id)
+	packet = append(packet, total, number)
+	packet = binary.LittleEndian.AppendUint16(packet, 1248)
+	return append(packet, payload...)
+}
+
+// a2sCompressedPayload prefixes compressed data with the decompressed size and checksum
+func a2sCompressedPayload(size, checksum uint32, compressed []byte) []byte {
+	payload := binary.LittleEndian.AppendUint32(nil, size)
+	payload = binary.LittleEndian.AppendUint32(payload, checksum)
+	return append(payload, compressed...)
+}
+
+func TestReadA2SResponse(t *testing.T) {
+	compressed := a2sCompressedPayload(uint32(len(rulesResponse)), rulesCRC, rulesBzip2)
+
+	tests := []struct {
+		name    string
+		packets [][]byte
+		want    []byte
+	}{
+		{
+			name:    "single packet",
+			packets: [][]byte{[]byte("\xff\xff\xff\xffIpayload")},
+			want:    []byte("Ipayload"),
+		},
+		{
+			name: "split in order",
+			packets: [][]byte{
+				a2sSplit(7, 3, 0, []byte("\xff\xff\xff\xffE")),
+				a2sSplit(7, 3, 1, []byte("first ")),
+				a2sSplit(7, 3, 2, []byte("second")),
+			},
+			want: []byte("Efirst second"),
+		},
+		{
+			name: "split out of order with duplicates",
+			packets: [][]byte{
+				a2sSplit(7, 3, 2, []byte("second")),
+				a2sSplit(7, 3, 0, []byte("\xff\xff\xff\xffE")),
+				a2sSplit(7, 3, 2, []byte("second")),
+				a2sSplit(7, 3, 1, []byte("first ")),
+			},
+			want: []byte("Efirst second"),
+		},
+		{
+			name: "split interleaved with another response",
+			packets: [][]byte{
+				a2sSplit(7, 2, 0, []byte("\xff\xff\xff\xffE")),
+				a2sSplit(8, 2, 1, []byte("other")),
+				a2sSplit(7, 3, 1, []byte("other")),
+				[]byte("\xff\xff\xff\xffIstray"),
+				a2sSplit(7, 2, 1, []byte("rules")),
+			},
+			want: []byte("Erules"),
+		},
+		{
+			name: "compressed",
+			packets: [][]byte{
+				a2sSplit(a2sCompressed|7, 2, 0, compressed[:30]),
+				a2sSplit(a2sCompressed|7, 2, 1, compressed[30:]),
+			},
+			want: rulesResponse[len(oobHeader):],
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := readA2SResponse(requestFake(t, tt.packets))
+		if err != nil {
+			t.Errorf("%s: readA2SResponse() returned error: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: readA2SResponse() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadA2SResponseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		packets [][]byte
+	}{
+		{
+			name:    "unknown header",
+			packets: [][]byte{[]byte("\xfd\xff\xff\xffI")},
+		},
+		{
+			name:    "part number out of range",
+			packets: [][]byte{a2sSplit(7, 2, 2, []byte("\xff\xff\xff\xffE"))},
+		},
+		{
+			name:    "missing part",
+			packets: [][]byte{a2sSplit(7, 2, 0, []byte("\xff\xff\xff\xffE"))},
+		},
+		{
+			name:    "reassembled without header",
+			packets: [][]byte{a2sSplit(7, 1, 0, []byte("E"))},
+		},
+		{
+			name: "checksum mismatch",
+			packets: [][]byte{
+				a2sSplit(a2sCompressed|7, 1, 0, a2sCompressedPayload(uint32(len(rulesResponse)), rulesCRC+1, rulesBzip2)),
+			},
+		},
+		{
+			name: "size mismatch",
+			packets: [][]byte{
+				a2sSplit(a2sCompressed|7, 1, 0, a2sCompressedPayload(uint32(len(rulesResponse))-1, rulesCRC, rulesBzip2)),
+			},
+		},
+		{
+			name: "size above the limit",
+			packets: [][]byte{
+				a2sSplit(a2sCompressed|7, 1, 0, a2sCompressedPayload(a2sMaxDecompressedSize+1, rulesCRC, rulesBzip2)),
+			},
+		},
+		{
+			name: "not bzip2",
+			packets: [][]byte{
+				a2sSplit(a2sCompressed|7, 1, 0, a2sCompressedPayload(uint32(len(rulesResponse)), rulesCRC, rulesResponse)),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if got, err := readA2SResponse(requestFake(t, tt.packets)); err == nil {
+			t.Errorf("%s: readA2SResponse() = %q, want an error", tt.name, got)
+		}
+	}
+}
+
+// a2sInfoPacket builds an A2S_INFO response, with the fields of The Ship between vac and
+// version, and the extra data after it
+func a2sInfoPacket(appID uint16, ship, edf []byte) []byte {
+	packet := []byte("\xff\xff\xff\xffI\x11Test server\x00de_dust2\x00cstrike\x00Counter-Strike: Source\x00")
+	packet = binary.LittleEndian.AppendUint16(packet, appID)
+	packet = append(packet, 12, 24, 2, 'd', 'l', 1, 1)
+	packet = append(packet, ship...)
+	packet = append(packet, "1.0.0.72\x00"...)
+	return append(packet, edf...)
+}
+
+func TestGetA2SInfo(t *testing.T) {
+	edf := []byte{0x80 | 0x10 | 0x40 | 0x20 | 0x01}
+	edf = binary.LittleEndian.AppendUint16(edf, 27016)
+	edf = binary.LittleEndian.AppendUint64(edf, 90071992547409920)
+	edf = binary.LittleEndian.AppendUint16(edf, 27020)
+	edf = append(edf, "SourceTV\x00alltalk,nocrits\x00"...)
+	edf = binary.LittleEndian.AppendUint64(edf, 0x0100000000000000|440)
+
+	tests := []struct {
+		name      string
+		challenge bool
+		packet    []byte
+		want      map[string]string
+		absent    []string
+	}{
+		{
+			name:   "without challenge",
+			packet: a2sInfoPacket(240, nil, nil),
+			want: map[string]string{
+				"hostname": "Test server", "mapname": "de_dust2", "gamename": "cstrike",
+				"gametype": "Counter-Strike: Source", "clients": "12", "sv_maxclients": "24", "bots": "2",
+				"protocol": "17", "appid": "240", "version": "1.0.0.72", "servertype": "d",
+				"environment": "l", "g_needpass": "1", "vac": "1",
+			},
+			absent: []string{"port", "steamid", "tvport", "tvname", "keywords"},
+		},
+		{
+			name:      "with challenge",
+			challenge: true,
+			packet:    a2sInfoPacket(240, nil, nil),
+			want:      map[string]string{"hostname": "Test server", "version": "1.0.0.72"},
+		},
+		{
+			name:   "the ship",
+			packet: a2sInfoPacket(theShipAppID, []byte{0, 3, 180}, nil),
+			want:   map[string]string{"appid": "2400", "version": "1.0.0.72", "clients": "12"},
+		},
+		{
+			name:      "extra data",
+			challenge: true,
+			packet:    a2sInfoPacket(0, nil, edf),
+			want: map[string]string{
+				"version": "1.0.0.72", "port": "27016", "steamid": "90071992547409920",
+				"tvport": "27020", "tvname": "SourceTV", "keywords": "alltalk,nocrits", "appid": "440",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		challenge := []byte{0x12, 0x34, 0x56, 0x78}
+		request := append(append([]byte(nil), oobHeader...), 'T')
+		request = append(request, a2sInfoPayload...)
+
+		address := serveUDP(t, func(b []byte) [][]byte {
+			switch {
+			case !tt.challenge && bytes.Equal(b, request):
+				return [][]byte{tt.packet}
+			case tt.challenge && bytes.Equal(b, append(request, challenge...)):
+				return [][]byte{tt.packet}
+			case tt.challenge && bytes.Equal(b, request):
+				return [][]byte{append([]byte("\xff\xff\xff\xffA"), challenge...)}
+			}
+			return nil
+		})
+
+		info, err := GetA2SInfo(context.Background(), address)
+		if err != nil {
+			t.Errorf("%s: GetA2SInfo() returned error: %v", tt.name, err)
+			continue
+		}
+		for key, want := range tt.want {
+			if info[key] != want {
+				t.Errorf("%s: GetA2SInfo()[%q] = %q, want %q", tt.name, key, info[key], want)
+			}
+		}
+		for _, key := range tt.absent {
+			if _, present := info[key]; present {
+				t.Errorf("%s: GetA2SInfo() has %q, want it absent", tt.name, key)
+			}
+		}
+		if info["ip"] != address {
+			t.Errorf("%s: GetA2SInfo()[\"ip\"] = %q, want %q", tt.name, info["ip"], address)
+		}
+	}
+}
+
+func TestGetA2SRulesCompressed(t *testing.T) {
+	compressed := a2sCompressedPayload(uint32(len(rulesResponse)), rulesCRC, rulesBzip2)
+	address := serveUDP(t, func(b []byte) [][]byte {
+		if !bytes.HasSuffix(b, []byte{0xde, 0xad, 0xbe, 0xef}) {
+			return [][]byte{[]byte("\xff\xff\xff\xffA\xde\xad\xbe\xef")}
+		}
+		return [][]byte{
+			a2sSplit(a2sCompressed|3, 2, 1, compressed[40:]),
+			a2sSplit(a2sCompressed|3, 2, 0, compressed[:40]),
+		}
+	})
+
+	rules, err := GetA2SRules(context.Background(), address)
+	if err != nil {
+		t.Fatalf("GetA2SRules() returned error: %v", err)
+	}
+	if len(rules) != 2 || rules["sv_cheats"] != "0" || rules["mp_timelimit"] != "30" {
+		t.Errorf("GetA2SRules() = %v, want sv_cheats 0 and mp_timelimit 30", rules)
+	}
+}
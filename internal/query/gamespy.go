@@ -0,0 +1,293 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The request types of the GameSpy query protocol
+const (
+	gamespyChallenge = 0x09
+	gamespyFullQuery = 0x00
+)
+
+const (
+	// gamespyMaxPackets bounds how many packets a split response may have
+	gamespyMaxPackets = 32
+	// gamespyLastPacket flags the number of the last packet of a split response
+	gamespyLastPacket = 0x80
+)
+
+// The sections of a full query response
+const (
+	gamespyServerSection = 0
+	gamespyPlayerSection = 1
+	gamespyTeamSection   = 2
+)
+
+var (
+	// gamespyRequestHeader starts every request
+	gamespyRequestHeader = []byte{0xFE, 0xFD}
+	// gamespyRequestAll asks for the server info, players and teams, split over several packets
+	// if needed
+	gamespyRequestAll = []byte{0xFF, 0xFF, 0xFF, 0x01}
+	// gamespySplitHeader follows the session id in every packet of a split response
+	gamespySplitHeader = []byte("splitnum\x00")
+)
+
+// gamespyDriver speaks the query protocol of GameSpy 3 and 4. Servers of both only answer queries
+// carrying a challenge they handed out first, and version 4 servers split long responses over
+// several packets, which is handled for both. The GameSpy master servers are shut down, and used
+// an encrypted protocol, so servers can't be listed from them.
+type gamespyDriver struct{}
+
+func (d gamespyDriver) ListServers(ctx context.Context, master string, opts ListOptions) ([]string, error) {
+	return nil, d.CheckList(opts)
+}
+
+func (gamespyDriver) CheckList(opts ListOptions) error {
+	return fmt.Errorf("listing servers from a master isn't supported by the gamespy protocol, " +
+		"use static servers, a server list url or lan discovery instead")
+}
+
+func (d gamespyDriver) Info(ctx context.Context, address string) (map[string]string, error) {
+	status, ping, err := d.query(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// GameSpy already uses hostname, mapname, gametype and gamename, so mostly the counts and
+	// password need translating
+	info := make(map[string]string, len(status.info)+7)
+	for k, v := range status.info {
+		info[k] = v
+	}
+	// later games, such as Minecraft, report game_id and map instead
+	for key, fallback := range map[string]string{"gamename": "game_id", "mapname": "map"} {
+		if _, present := info[key]; !present {
+			if value, present := status.info[fallback]; present {
+				info[key] = value
+			}
+		}
+	}
+	info["clients"] = status.info["numplayers"]
+	if info["clients"] == "" {
+		info["clients"] = strconv.Itoa(len(status.players))
+	}
+	info["sv_maxclients"] = status.info["maxplayers"]
+	if bots, present := status.info["numbots"]; present {
+		info["bots"] = bots
+	}
+	if password, present := status.info["password"]; present {
+		info["g_needpass"] = password
+	}
+	info["ip"] = address
+	info["ping"] = strconv.FormatInt(ping.Milliseconds(), 10)
+
+	return info, nil
+}
+
+func (d gamespyDriver) Players(ctx context.Context, address string) ([]Player, error) {
+	status, _, err := d.query(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	players := []Player{}
+	for _, row := range status.players {
+		score, _ := strconv.Atoi(row["score"])
+		ping, _ := strconv.Atoi(row["ping"])
+		players = append(players, Player{Name: row["player"], Score: score, Ping: ping})
+	}
+	return players, nil
+}
+
+// Rules returns the server info, which holds every key the server reports
+func (d gamespyDriver) Rules(ctx context.Context, address string) (map[string]string, error) {
+	status, _, err := d.query(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return status.info, nil
+}
+
+// gamespyStatus is a parsed full query response
+type gamespyStatus struct {
+	info    map[string]string
+	players []map[string]string
+	teams   []map[string]string
+}
+
+// query sends a full query, preceded by the challenge handshake, and returns the parsed response
+// with the round trip time of the full query
+func (d gamespyDriver) query(ctx context.Context, address string) (*gamespyStatus, time.Duration, error) {
+	conn, closeConn, err := dial(ctx, address)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer closeConn()
+
+	session := make([]byte, 4)
+	rand.Read(session)
+	// some servers only echo session ids within this mask correctly
+	binary.BigEndian.PutUint32(session, binary.BigEndian.Uint32(session)&0x0F0F0F0F)
+
+	challenge, err := gamespyHandshake(conn, session)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		return nil, 0, err
+	}
+
+	request := append(append([]byte(nil), gamespyRequestHeader...), gamespyFullQuery)
+	request = append(request, session...)
+	request = append(request, challenge...)
+	request = append(request, gamespyRequestAll...)
+
+	start := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return nil, 0, err
+	}
+
+	status, err := readGameSpyResponse(conn, session)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		return nil, 0, err
+	}
+	return status, time.Since(start), nil
+}
+
+// gamespyHandshake requests a challenge, and returns it in the form the full query carries it
+func gamespyHandshake(conn net.Conn, session []byte) ([]byte, error) {
+	request := append(append([]byte(nil), gamespyRequestHeader...), gamespyChallenge)
+	request = append(request, session...)
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, a2sMaxPacketSize)
+	read, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	response := buf[:read]
+	if len(response) < 5 || response[0] != gamespyChallenge || !bytes.Equal(response[1:5], session) {
+		return nil, fmt.Errorf("malformed gamespy challenge")
+	}
+
+	// the challenge is sent as a decimal string, and echoed as a big-endian 32-bit integer
+	r := packetReader{b: response[5:]}
+	challenge, err := strconv.ParseInt(strings.TrimSpace(r.string()), 10, 64)
+	if r.err != nil || err != nil {
+		return nil, fmt.Errorf("malformed gamespy challenge")
+	}
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(challenge))
+	return b, nil
+}
+
+// readGameSpyResponse reads the packets of a full query response, which may arrive in any order,
+// and parses them
+func readGameSpyResponse(conn net.Conn, session []byte) (*gamespyStatus, error) {
+	status := &gamespyStatus{info: map[string]string{}}
+	buf := make([]byte, a2sMaxPacketSize)
+	received := map[int]bool{}
+	last := -1
+
+	for last < 0 || len(received) < last+1 {
+		read, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		packet := buf[:read]
+		if len(packet) < 5 || packet[0] != gamespyFullQuery || !bytes.Equal(packet[1:5], session) {
+			continue // a stray reply to an earlier request
+		}
+		packet = packet[5:]
+
+		if !bytes.HasPrefix(packet, gamespySplitHeader) {
+			// servers which don't split their response send it as is, starting with the server info
+			parseGameSpyPacket(append([]byte{gamespyServerSection}, packet...), status)
+			return status, nil
+		}
+		packet = packet[len(gamespySplitHeader):]
+		if len(packet) == 0 {
+			return nil, fmt.Errorf("malformed gamespy split packet")
+		}
+
+		number := int(packet[0] &^ gamespyLastPacket)
+		if number >= gamespyMaxPackets {
+			return nil, fmt.Errorf("gamespy response split over too many packets")
+		}
+		if packet[0]&gamespyLastPacket != 0 {
+			last = number
+		}
+		if !received[number] {
+			received[number] = true
+			parseGameSpyPacket(packet[1:], status)
+		}
+	}
+
+	return status, nil
+}
+
+// parseGameSpyPacket reads the sections of a packet into the status. The server info is a list of
+// keys and values, while the players and teams are a list of fields, each followed by the row it
+// starts at and the values of the rows from there on. A value cut off at the end of a packet is
+// sent again in full in the next one, so whatever can't be read at the end is dropped.
+func parseGameSpyPacket(packet []byte, status *gamespyStatus) {
+	r := packetReader{b: packet}
+	for r.err == nil && len(r.rest()) > 0 {
+		switch section := r.byte(); section {
+		case gamespyServerSection:
+			for {
+				key := r.string()
+				if key == "" || r.err != nil {
+					break
+				}
+				value := r.string()
+				if r.err != nil {
+					break
+				}
+				status.info[key] = value
+			}
+
+		case gamespyPlayerSection, gamespyTeamSection:
+			rows := &status.players
+			if section == gamespyTeamSection {
+				rows = &status.teams
+			}
+			for {
+				field := r.string()
+				if field == "" || r.err != nil {
+					break
+				}
+				field = strings.TrimSuffix(strings.TrimSuffix(field, "_t"), "_")
+				row := int(r.byte())
+				for ; ; row++ {
+					value := r.string()
+					if value == "" || r.err != nil {
+						break
+					}
+					for len(*rows) <= row {
+						*rows = append(*rows, map[string]string{})
+					}
+					(*rows)[row][field] = value
+				}
+			}
+
+		default:
+			return // an unknown section, the rest of the packet can't be read
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+var testSession = []byte{0x01, 0x02, 0x03, 0x04}
+
+// gamespyPacket builds a packet of a full query response, split if number is not negative
+func gamespyPacket(session []byte, number int, payload string) []byte {
+	packet := append([]byte{gamespyFullQuery}, session...)
+	if number >= 0 {
+		packet = append(packet, gamespySplitHeader...)
+		packet = append(packet, byte(number))
+	}
+	return append(packet, payload...)
+}
+
+func TestReadGameSpyResponse(t *testing.T) {
+	info := map[string]string{"hostname": "Test server", "mapname": "Strike at Karkand", "numplayers": "2"}
+	players := []map[string]string{{"player": "alice", "score": "10"}, {"player": "bob", "score": "-2"}}
+	teams := []map[string]string{{"team": "MEC"}, {"team": "USMC"}}
+
+	tests := []struct {
+		name    string
+		packets [][]byte
+		want    gamespyStatus
+	}{
+		{
+			name: "unsplit",
+			packets: [][]byte{gamespyPacket(testSession, -1,
+				"hostname\x00Test server\x00mapname\x00Strike at Karkand\x00numplayers\x002\x00\x00"+
+					"\x01player_\x00\x00alice\x00bob\x00\x00score_\x00\x0010\x00-2\x00\x00\x00"+
+					"\x02team_t\x00\x00MEC\x00USMC\x00\x00\x00",
+			)},
+			want: gamespyStatus{info: info, players: players, teams: teams},
+		},
+		{
+			name: "split",
+			packets: [][]byte{
+				gamespyPacket(testSession, 0, "\x00hostname\x00Test server\x00mapname\x00Strike at Karkand\x00\x00"),
+				gamespyPacket(testSession, 1, "\x00numplayers\x002\x00\x00\x01player_\x00\x00alice\x00bob\x00\x00\x00"),
+				gamespyPacket(testSession, 2|gamespyLastPacket,
+					"\x01score_\x00\x0010\x00-2\x00\x00\x00\x02team_t\x00\x00MEC\x00USMC\x00\x00\x00"),
+			},
+			want: gamespyStatus{info: info, players: players, teams: teams},
+		},
+		{
+			name: "split out of order",
+			packets: [][]byte{
+				gamespyPacket(testSession, 2|gamespyLastPacket,
+					"\x01score_\x00\x0010\x00-2\x00\x00\x00\x02team_t\x00\x00MEC\x00USMC\x00\x00\x00"),
+				gamespyPacket(testSession, 1, "\x00numplayers\x002\x00\x00\x01player_\x00\x00alice\x00bob\x00\x00\x00"),
+				gamespyPacket(testSession, 1, "\x00numplayers\x009\x00\x00"),
+				gamespyPacket(testSession, 0, "\x00hostname\x00Test server\x00mapname\x00Strike at Karkand\x00\x00"),
+			},
+			want: gamespyStatus{info: info, players: players, teams: teams},
+		},
+		{
+			name: "stray packets",
+			packets: [][]byte{
+				gamespyPacket([]byte{0x0a, 0x0b, 0x0c, 0x0d}, -1, "hostname\x00Other server\x00\x00"),
+				[]byte{gamespyChallenge, 0x01, 0x02, 0x03, 0x04},
+				gamespyPacket(testSession, -1, "hostname\x00Test server\x00\x00"),
+			},
+			want: gamespyStatus{info: map[string]string{"hostname": "Test server"}},
+		},
+		{
+			name: "player value cut off at the end of a packet",
+			packets: [][]byte{
+				gamespyPacket(testSession, 0, "\x00hostname\x00Test server\x00\x00\x01player_\x00\x00alice\x00bo"),
+				gamespyPacket(testSession, 1|gamespyLastPacket,
+					"\x01player_\x00\x01bob\x00\x00score_\x00\x0010\x00-2\x00\x00\x00"),
+			},
+			want: gamespyStatus{info: map[string]string{"hostname": "Test server"}, players: players},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := readGameSpyResponse(requestFake(t, tt.packets), testSession)
+		if err != nil {
+			t.Errorf("%s: readGameSpyResponse() returned error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: readGameSpyResponse() = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestReadGameSpyResponseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		packets [][]byte
+	}{
+		{
+			name:    "missing packet",
+			packets: [][]byte{gamespyPacket(testSession, 1|gamespyLastPacket, "\x00hostname\x00Test server\x00\x00")},
+		},
+		{
+			name:    "packet number out of range",
+			packets: [][]byte{gamespyPacket(testSession, gamespyMaxPackets, "\x00hostname\x00Test server\x00\x00")},
+		},
+		{
+			name:    "split packet without number",
+			packets: [][]byte{append(gamespyPacket(testSession, -1, ""), gamespySplitHeader...)},
+		},
+	}
+
+	for _, tt := range tests {
+		if got, err := readGameSpyResponse(requestFake(t, tt.packets), testSession); err == nil {
+			t.Errorf("%s: readGameSpyResponse() = %+v, want an error", tt.name, *got)
+		}
+	}
+}
+
+func TestGameSpyInfo(t *testing.T) {
+	// a Minecraft server, which reports game_id and map instead of gamename and mapname
+	address := serveUDP(t, func(b []byte) [][]byte {
+		if len(b) < 7 || !bytes.HasPrefix(b, gamespyRequestHeader) {
+			return nil
+		}
+		session := b[3:7]
+		switch {
+		case b[2] == gamespyChallenge && len(b) == 7:
+			return [][]byte{append(append([]byte{gamespyChallenge}, session...), " 9513307\x00"...)}
+		case b[2] == gamespyFullQuery && bytes.Equal(b[7:], []byte{0x00, 0x91, 0x29, 0x5b, 0xFF, 0xFF, 0xFF, 0x01}):
+			return [][]byte{gamespyPacket(session, gamespyLastPacket,
+				"\x00hostname\x00A Minecraft Server\x00gametype\x00SMP\x00game_id\x00MINECRAFT\x00"+
+					"map\x00world\x00numplayers\x002\x00maxplayers\x0020\x00\x00"+
+					"\x01player_\x00\x00alice\x00bob\x00\x00\x00")}
+		}
+		return nil
+	})
+
+	info, err := gamespyDriver{}.Info(context.Background(), address)
+	if err != nil {
+		t.Fatalf("Info() returned error: %v", err)
+	}
+
+	want := map[string]string{
+		"hostname":      "A Minecraft Server",
+		"gametype":      "SMP",
+		"gamename":      "MINECRAFT",
+		"mapname":       "world",
+		"clients":       "2",
+		"sv_maxclients": "20",
+		"ip":            address,
+	}
+	for key, value := range want {
+		if info[key] != value {
+			t.Errorf("Info()[%q] = %q, want %q", key, info[key], value)
+		}
+	}
+	if _, present := info["bots"]; present {
+		t.Errorf("Info() has bots, want it absent as the server doesn't report them")
+	}
+}
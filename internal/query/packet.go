@@ -0,0 +1,68 @@
+package query
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// errShortPacket is returned when a packet ends before all of its fields were read
+var errShortPacket = fmt.Errorf("packet ended early")
+
+// packetReader reads the little-endian fields and null-terminated strings of a binary response.
+// Reading past the end sets err and returns zero values, so a packet can be read field by field
+// and err checked once at the end.
+type packetReader struct {
+	b   []byte
+	err error
+}
+
+func (r *packetReader) take(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errShortPacket
+		return make([]byte, n)
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *packetReader) byte() byte {
+	return r.take(1)[0]
+}
+
+func (r *packetReader) short() uint16 {
+	return binary.LittleEndian.Uint16(r.take(2))
+}
+
+func (r *packetReader) long() uint32 {
+	return binary.LittleEndian.Uint32(r.take(4))
+}
+
+func (r *packetReader) longlong() uint64 {
+	return binary.LittleEndian.Uint64(r.take(8))
+}
+
+func (r *packetReader) float() float32 {
+	return math.Float32frombits(r.long())
+}
+
+func (r *packetReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(r.b, 0)
+	if end < 0 {
+		r.err = errShortPacket
+		return ""
+	}
+	s := string(r.b[:end])
+	r.b = r.b[end+1:]
+	return s
+}
+
+// rest returns the bytes not read yet
+func (r *packetReader) rest() []byte {
+	return r.b
+}
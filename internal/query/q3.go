@@ -0,0 +1,243 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trondhumbor/pigeon/internal/colors"
+)
+
+// q3Driver speaks the connectionless protocol of Quake 3 and the games and forks built on it:
+// getservers to master servers, and getinfo and getstatus to game servers
+type q3Driver struct{}
+
+func (d q3Driver) ListServers(ctx context.Context, master string, opts ListOptions) ([]string, error) {
+	if err := d.CheckList(opts); err != nil {
+		return nil, err
+	}
+	return GetMasterServerResponse(ctx, master, opts.GameId, opts.Version, opts.IPv6)
+}
+
+func (q3Driver) CheckList(opts ListOptions) error {
+	if opts.Version == 0 {
+		return fmt.Errorf("q3 master servers need a protocol version to list servers for")
+	}
+	return nil
+}
+
+func (q3Driver) Info(ctx context.Context, address string) (map[string]string, error) {
+	return GetSingleServerResponse(ctx, address)
+}
+
+func (q3Driver) Players(ctx context.Context, address string) ([]Player, error) {
+	_, players, err := GetStatusResponse(ctx, address)
+	return players, err
+}
+
+// Rules returns the serverinfo of a getstatus response
+func (q3Driver) Rules(ctx context.Context, address string) (map[string]string, error) {
+	info, _, err := GetStatusResponse(ctx, address)
+	return info, err
+}
+
+func (q3Driver) DiscoverLAN(ctx context.Context, broadcasts []string, wait time.Duration) (map[string]map[string]string, error) {
+	return DiscoverLAN(ctx, broadcasts, wait)
+}
+
+// GetMasterServerResponse requests the servers of a game from a master server. If extended is set,
+// getserversExt is used so the master also lists IPv6 servers.
+func GetMasterServerResponse(ctx context.Context, masterServer string, gameId string, protocol int, extended bool) ([]string, error) {
+	request := fmt.Sprintf("getservers %s %d full empty", gameId, protocol)
+	if extended {
+		request = fmt.Sprintf("getserversExt %s %d full empty", gameId, protocol)
+	}
+
+	masterResponse, err := sendMessage(ctx, masterServer, request, endsMasterList)
+	if err != nil {
+		slog.Warn("couldn't get response from master server", "gameId", gameId, "master", masterServer, "err", err)
+		return []string{}, fmt.Errorf("couldn't get response from master server: %v", err)
+	}
+
+	servers, _ := parseMasterResponse(masterResponse)
+	slog.Info("master server responded", "gameId", gameId, "master", masterServer, "servers", len(servers))
+	return servers, nil
+}
+
+// parseMasterResponse reads the server addresses out of the, possibly several, packets of a
+// getservers or getserversExt response, and reports whether the EOT ending the list was among
+// them. Each address is a '\' followed by 4 bytes of IPv4 address, or a '/' followed by 16 bytes
+// of IPv6 address, and then 2 bytes of port. The address bytes may themselves be '\' or '/', so
+// the response is read entry by entry instead of split on them.
+func parseMasterResponse(response []byte) (servers []string, complete bool) {
+	servers = []string{}
+	for i := 0; i < len(response); {
+		switch {
+		case bytes.HasPrefix(response[i:], oobHeader):
+			// skip the header and command name at the start of every packet
+			i += len(oobHeader)
+			for i < len(response) && response[i] != '\\' && response[i] != '/' {
+				i++
+			}
+
+		case isEndMarker(response[i:]):
+			// the end of a packet, possibly padded with NULs, after which another may follow.
+			// Only the last packet of a list ends with EOT, the others may end with EOF.
+			complete = complete || bytes.HasPrefix(response[i:], []byte("\\EOT"))
+			i += 4
+			for i < len(response) && response[i] == 0 {
+				i++
+			}
+
+		case response[i] == '\\' && i+1+net.IPv4len+2 <= len(response):
+			servers = appendAddress(servers, net.IP(response[i+1:i+1+net.IPv4len]), response[i+1+net.IPv4len:])
+			i += 1 + net.IPv4len + 2
+
+		case response[i] == '/' && i+1+net.IPv6len+2 <= len(response):
+			servers = appendAddress(servers, net.IP(response[i+1:i+1+net.IPv6len]), response[i+1+net.IPv6len:])
+			i += 1 + net.IPv6len + 2
+
+		default:
+			// a truncated or unknown entry, nothing after it can be trusted
+			return
+		}
+	}
+	return
+}
+
+// endsMasterList reports whether the packet is the last of a getservers or getserversExt response
+func endsMasterList(packet []byte) bool {
+	_, complete := parseMasterResponse(packet)
+	return complete
+}
+
+// isEndMarker reports whether b starts with the EOT or EOF ending a packet. The marker is only
+// recognized if nothing but padding or the next packet follows it, since an IPv4 entry such as
+// 69.79.84.x reads as EOT too.
+func isEndMarker(b []byte) bool {
+	if !bytes.HasPrefix(b, []byte("\\EOT")) && !bytes.HasPrefix(b, []byte("\\EOF")) {
+		return false
+	}
+	rest := b[4:]
+	return len(rest) == 0 || bytes.HasPrefix(rest, []byte{0, 0, 0}) || bytes.HasPrefix(rest, oobHeader)
+}
+
+// appendAddress appends the address of the ip and the big-endian port at the start of port,
+// skipping unusable ones
+func appendAddress(servers []string, ip net.IP, port []byte) []string {
+	p := binary.BigEndian.Uint16(port[:2])
+	if p == 0 || ip.IsUnspecified() {
+		return servers
+	}
+	// JoinHostPort wraps IPv6 addresses in brackets, as in [::1]:27960
+	return append(servers, net.JoinHostPort(ip.String(), strconv.Itoa(int(p))))
+}
+
+func GetSingleServerResponse(ctx context.Context, server string) (map[string]string, error) {
+	challenge := make([]byte, 4)
+	rand.Seed(time.Now().UnixNano())
+	rand.Read(challenge)
+	hex := fmt.Sprintf("%x", challenge)
+
+	message := fmt.Sprintf("getinfo %s", hex)
+	start := time.Now()
+	serverResponse, err := sendMessage(ctx, server, message, nil)
+	ping := time.Since(start)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get response from game server")
+	}
+
+	info, err := parseInfoResponse(serverResponse, hex)
+	if err != nil {
+		return nil, err
+	}
+	info["ip"] = server
+	info["ping"] = strconv.FormatInt(ping.Milliseconds(), 10)
+
+	slog.Debug("got server response", "server", server)
+
+	return info, nil
+}
+
+// parseInfoResponse parses the infostring of a getinfo response, and checks that it echoes the challenge
+func parseInfoResponse(serverResponse []byte, challenge string) (map[string]string, error) {
+	chunks := bytes.Split(serverResponse, []byte("\\"))[1:]
+	if len(chunks)%2 != 0 {
+		return nil, fmt.Errorf("malformed server response, key/value length not even")
+	}
+
+	info := map[string]string{}
+	for i := 0; i < len(chunks)-1; i += 2 {
+		info[string(chunks[i])] = string(chunks[i+1])
+	}
+
+	if returnedChallenge, present := info["challenge"]; present {
+		if returnedChallenge != challenge {
+			return nil, fmt.Errorf("serverinfo challenge mismatch")
+		}
+	} else {
+		return nil, fmt.Errorf("serverinfo challenge absent")
+	}
+
+	colors.StripInfo(info, "hostname", "mapname")
+
+	return info, nil
+}
+
+func GetStatusResponse(ctx context.Context, server string) (map[string]string, []Player, error) {
+	challenge := make([]byte, 4)
+	rand.Read(challenge)
+	hex := fmt.Sprintf("%x", challenge)
+
+	serverResponse, err := sendMessage(ctx, server, fmt.Sprintf("getstatus %s", hex), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't get response from game server")
+	}
+
+	lines := strings.Split(strings.TrimRight(string(serverResponse), "\n"), "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], "statusResponse") {
+		return nil, nil, fmt.Errorf("malformed status response")
+	}
+
+	chunks := strings.Split(lines[1], "\\")[1:]
+	if len(chunks)%2 != 0 {
+		return nil, nil, fmt.Errorf("malformed status response, key/value length not even")
+	}
+
+	info := map[string]string{}
+	for i := 0; i < len(chunks)-1; i += 2 {
+		info[chunks[i]] = chunks[i+1]
+	}
+
+	// not every server echoes the challenge of a getstatus, but those that do must echo ours
+	if returnedChallenge, present := info["challenge"]; present && returnedChallenge != hex {
+		return nil, nil, fmt.Errorf("status challenge mismatch")
+	}
+
+	players := []Player{}
+	for _, line := range lines[2:] {
+		// each line is: <score> <ping> "<name>"
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			return nil, nil, fmt.Errorf("malformed player line %q", line)
+		}
+
+		score, serr := strconv.Atoi(fields[0])
+		ping, perr := strconv.Atoi(fields[1])
+		if serr != nil || perr != nil {
+			return nil, nil, fmt.Errorf("malformed player line %q", line)
+		}
+
+		name := strings.Trim(fields[2], "\"")
+		players = append(players, Player{Name: colors.Strip(name), RawName: name, Score: score, Ping: ping})
+	}
+
+	return info, players, nil
+}
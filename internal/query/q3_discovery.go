@@ -0,0 +1,89 @@
+package query
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DiscoverLAN broadcasts getinfo to the given broadcast addresses, and returns the info of every
+// server which replied within wait, keyed by its address. It is meant for local networks without
+// a reachable master server.
+func DiscoverLAN(ctx context.Context, broadcasts []string, wait time.Duration) (map[string]map[string]string, error) {
+	var lc net.ListenConfig
+	conn, err := lc.ListenPacket(ctx, "udp4", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("listening for replies: %v", err)
+	}
+	defer conn.Close()
+
+	challenge := make([]byte, 4)
+	rand.Read(challenge)
+	hex := fmt.Sprintf("%x", challenge)
+
+	message := append(append([]byte(nil), oobHeader...), fmt.Sprintf("getinfo %s", hex)...)
+	sent := 0
+	for _, broadcast := range broadcasts {
+		addr, err := net.ResolveUDPAddr("udp4", broadcast)
+		if err != nil {
+			slog.Warn("invalid broadcast address", "address", broadcast, "err", err)
+			continue
+		}
+		if _, err := conn.WriteTo(message, addr); err != nil {
+			slog.Warn("couldn't broadcast getinfo", "address", broadcast, "err", err)
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		return nil, fmt.Errorf("couldn't broadcast to any of the %d addresses", len(broadcasts))
+	}
+	start := time.Now()
+
+	deadline := start.Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	// unblock the reads below as soon as the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	servers := make(map[string]map[string]string)
+	response := make([]byte, 8192)
+	for {
+		read, from, err := conn.ReadFrom(response)
+		if err != nil {
+			// the deadline ends the collection of replies
+			break
+		}
+
+		info, err := parseInfoResponse(response[:read], hex)
+		if err != nil {
+			slog.Debug("ignoring reply to broadcast", "from", from.String(), "err", err)
+			continue
+		}
+		info["ip"] = from.String()
+		info["ping"] = strconv.FormatInt(time.Since(start).Milliseconds(), 10)
+		servers[from.String()] = info
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	slog.Info("lan discovery finished", "broadcasts", sent, "servers", len(servers))
+	return servers, nil
+}
@@ -0,0 +1,206 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+// masterPacket builds a getservers response packet from its entries
+func masterPacket(command string, entries ...[]byte) []byte {
+	packet := append(append([]byte(nil), oobHeader...), command...)
+	for _, e := range entries {
+		packet = append(packet, e...)
+	}
+	return packet
+}
+
+func ipv4Entry(a, b, c, d byte, port uint16) []byte {
+	return []byte{'\\', a, b, c, d, byte(port >> 8), byte(port)}
+}
+
+func ipv6Entry(ip [16]byte, port uint16) []byte {
+	return append(append([]byte{'/'}, ip[:]...), byte(port>>8), byte(port))
+}
+
+var (
+	eot = []byte("\\EOT\x00\x00\x00")
+	eof = []byte("\\EOF\x00\x00\x00")
+
+	loopback6 = [16]byte{15: 1}
+	// an address consisting of nothing but separator bytes
+	slashes6 = [16]byte{'/', '\\', '/', '\\', '/', '\\', '/', '\\', '/', '\\', '/', '\\', '/', '\\', '/', '\\'}
+)
+
+func TestParseMasterResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response []byte
+		want     []string
+		complete bool
+	}{
+		{
+			name:     "empty list",
+			response: masterPacket("getserversResponse", eot),
+			want:     []string{},
+			complete: true,
+		},
+		{
+			name: "single packet",
+			response: masterPacket("getserversResponse",
+				ipv4Entry(192, 168, 0, 1, 27960),
+				ipv4Entry(10, 0, 0, 2, 27961),
+				eot,
+			),
+			want:     []string{"192.168.0.1:27960", "10.0.0.2:27961"},
+			complete: true,
+		},
+		{
+			name: "end marker without padding",
+			response: masterPacket("getserversResponse",
+				ipv4Entry(192, 168, 0, 1, 27960),
+				[]byte("\\EOT"),
+			),
+			want:     []string{"192.168.0.1:27960"},
+			complete: true,
+		},
+		{
+			name: "multiple packets",
+			response: bytes.Join([][]byte{
+				masterPacket("getserversResponse", ipv4Entry(1, 2, 3, 4, 27960), eof),
+				masterPacket("getserversResponse", ipv4Entry(5, 6, 7, 8, 27960), eof),
+				masterPacket("getserversResponse", ipv4Entry(9, 10, 11, 12, 27960), eot),
+			}, nil),
+			want:     []string{"1.2.3.4:27960", "5.6.7.8:27960", "9.10.11.12:27960"},
+			complete: true,
+		},
+		{
+			name: "packets without end markers",
+			response: bytes.Join([][]byte{
+				masterPacket("getserversResponse", ipv4Entry(1, 2, 3, 4, 27960)),
+				masterPacket("getserversResponse", ipv4Entry(5, 6, 7, 8, 27960), eot),
+			}, nil),
+			want:     []string{"1.2.3.4:27960", "5.6.7.8:27960"},
+			complete: true,
+		},
+		{
+			name: "mixed ipv4 and ipv6",
+			response: bytes.Join([][]byte{
+				masterPacket("getserversExtResponse",
+					ipv4Entry(1, 2, 3, 4, 27960),
+					ipv6Entry(loopback6, 27960),
+					ipv4Entry(5, 6, 7, 8, 27961),
+					eof,
+				),
+				masterPacket("getserversExtResponse",
+					ipv6Entry([16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 0x2f}, 27962),
+					eot,
+				),
+			}, nil),
+			want:     []string{"1.2.3.4:27960", "[::1]:27960", "5.6.7.8:27961", "[2001:db8::2f]:27962"},
+			complete: true,
+		},
+		{
+			name: "address bytes which are separators",
+			response: masterPacket("getserversExtResponse",
+				ipv4Entry('\\', '/', '\\', '/', 0x5c2f),
+				ipv6Entry(slashes6, 0x2f5c),
+				eot,
+			),
+			want:     []string{"92.47.92.47:23599", "[2f5c:2f5c:2f5c:2f5c:2f5c:2f5c:2f5c:2f5c]:12124"},
+			complete: true,
+		},
+		{
+			name: "address starting with the EOT bytes",
+			response: masterPacket("getserversResponse",
+				ipv4Entry('E', 'O', 'T', 1, 27960),
+				ipv4Entry('E', 'O', 'F', 0, 27960),
+				ipv4Entry(1, 2, 3, 4, 27960),
+				eot,
+			),
+			want:     []string{"69.79.84.1:27960", "69.79.70.0:27960", "1.2.3.4:27960"},
+			complete: true,
+		},
+		{
+			name: "address starting with the EOT bytes last in the packet",
+			response: masterPacket("getserversResponse",
+				ipv4Entry(1, 2, 3, 4, 27960),
+				ipv4Entry('E', 'O', 'T', 0, 27960),
+				eot,
+			),
+			want:     []string{"1.2.3.4:27960", "69.79.84.0:27960"},
+			complete: true,
+		},
+		{
+			name: "unusable addresses",
+			response: masterPacket("getserversResponse",
+				ipv4Entry(0, 0, 0, 0, 27960),
+				ipv4Entry(1, 2, 3, 4, 0),
+				ipv6Entry([16]byte{}, 27960),
+				ipv4Entry(5, 6, 7, 8, 27960),
+				eot,
+			),
+			want:     []string{"5.6.7.8:27960"},
+			complete: true,
+		},
+		{
+			name: "truncated ipv4 tail",
+			response: masterPacket("getserversResponse",
+				ipv4Entry(1, 2, 3, 4, 27960),
+				ipv4Entry(5, 6, 7, 8, 27960)[:5],
+			),
+			want: []string{"1.2.3.4:27960"},
+		},
+		{
+			name: "truncated ipv6 tail",
+			response: masterPacket("getserversExtResponse",
+				ipv4Entry(1, 2, 3, 4, 27960),
+				ipv6Entry(loopback6, 27960)[:17],
+			),
+			want: []string{"1.2.3.4:27960"},
+		},
+		{
+			name: "garbage after an entry",
+			response: masterPacket("getserversResponse",
+				ipv4Entry(1, 2, 3, 4, 27960),
+				[]byte("garbage"),
+				ipv4Entry(5, 6, 7, 8, 27960),
+			),
+			want: []string{"1.2.3.4:27960"},
+		},
+	}
+
+	for _, tt := range tests {
+		got, complete := parseMasterResponse(tt.response)
+		if !reflect.DeepEqual(got, tt.want) || complete != tt.complete {
+			t.Errorf("%s: parseMasterResponse() = %v, %v, want %v, %v", tt.name, got, complete, tt.want, tt.complete)
+		}
+	}
+}
+
+func TestGetMasterServerResponse(t *testing.T) {
+	requests := make(chan string, 1)
+	master := serveUDP(t, func(b []byte) [][]byte {
+		requests <- string(b)
+		return [][]byte{
+			masterPacket("getserversExtResponse", ipv4Entry(1, 2, 3, 4, 27960), eof),
+			// this packet ends with the bytes \EOT without being the end of the list
+			masterPacket("getserversExtResponse", ipv6Entry(loopback6, 27960), ipv4Entry('E', 'O', '\\', 'E', 0x4f54)),
+			masterPacket("getserversExtResponse", ipv4Entry(5, 6, 7, 8, 27960), eot),
+		}
+	})
+
+	servers, err := GetMasterServerResponse(context.Background(), master, "baseq3", 68, true)
+	if err != nil {
+		t.Fatalf("GetMasterServerResponse() returned error: %v", err)
+	}
+
+	if request, want := <-requests, "\xff\xff\xff\xffgetserversExt baseq3 68 full empty"; request != want {
+		t.Errorf("master got request %q, want %q", request, want)
+	}
+	want := []string{"1.2.3.4:27960", "[::1]:27960", "69.79.92.69:20308", "5.6.7.8:27960"}
+	if !reflect.DeepEqual(servers, want) {
+		t.Errorf("GetMasterServerResponse() = %v, want %v", servers, want)
+	}
+}
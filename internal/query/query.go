@@ -1,104 +1,181 @@
 package query
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/binary"
+	"context"
 	"fmt"
-	"log"
-	"math/rand"
 	"net"
-	"regexp"
-	"strconv"
+	"sort"
 	"time"
 )
 
-var (
-	colorRegex = regexp.MustCompile(`\^[\d:;]`)
-)
+// oobHeader starts every connectionless packet
+var oobHeader = []byte{0xFF, 0xFF, 0xFF, 0xFF}
 
-func GetMasterServerResponse(masterServer string, gameId string, protocol int) []string {
-	masterResponse, err := sendMessage(masterServer, fmt.Sprintf("getservers %s %d full empty", gameId, protocol), true)
-	if err != nil {
-		log.Println("couldn't get response from master server", err.Error())
-		return []string{}
-	}
-	chunks := bytes.Split(masterResponse, []byte("\\"))
-	servers := []string{}
-	for i := 1; i < len(chunks)-1; i++ {
-		server := chunks[i]
-		if len(server) != 6 {
-			continue
-		}
-		ip := net.IP(server[0:4]).String()
-		port := strconv.Itoa(int(binary.BigEndian.Uint16(server[4:6])))
-		servers = append(servers, ip+":"+port)
-	}
-	log.Printf("master server %q (%s) responded with %d servers", masterServer, gameId, len(servers))
-	return servers
+// DefaultDriver is the driver of master servers which don't name one, as in configs written
+// before there were several
+const DefaultDriver = "q3"
+
+// ListOptions is what a master server is asked to list servers for
+type ListOptions struct {
+	GameId string
+	// Version is the protocol version of the game, for the protocols which have one
+	Version int
+	// IPv6 asks for IPv6 servers too, for the protocols which tell them apart
+	IPv6 bool
+	// Region limits the servers to a region, for the protocols which have them
+	Region string
+	// Filter is passed on to the master server as is, for the protocols which support one
+	Filter string
 }
 
-func GetSingleServerResponse(server string) (map[string]string, error) {
-	challenge := make([]byte, 4)
-	rand.Seed(time.Now().UnixNano())
-	rand.Read(challenge)
-	hex := fmt.Sprintf("%x", challenge)
+// Driver speaks the query protocol of a family of games. The info of a server is normalized to
+// the keys of the Quake 3 infostring: hostname, mapname, gametype, gamename, clients,
+// sv_maxclients and bots, in addition to ip and ping.
+type Driver interface {
+	// ListServers returns the addresses of the servers a master server lists
+	ListServers(ctx context.Context, master string, opts ListOptions) ([]string, error)
+	// Info queries the normalized info of a game server
+	Info(ctx context.Context, address string) (map[string]string, error)
+	// Players queries the players on a game server
+	Players(ctx context.Context, address string) ([]Player, error)
+}
 
-	message := fmt.Sprintf("getinfo %s", hex)
-	serverResponse, err := sendMessage(server, message, false)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't get response from game server")
+// LANDiscoverer is implemented by drivers which can find servers on local networks by broadcasting
+type LANDiscoverer interface {
+	// DiscoverLAN broadcasts to the given addresses, and returns the info of every server which
+	// replied within wait, keyed by its address
+	DiscoverLAN(ctx context.Context, broadcasts []string, wait time.Duration) (map[string]map[string]string, error)
+}
+
+// RulesQuerier is implemented by drivers which can query the public console variables of a server
+type RulesQuerier interface {
+	Rules(ctx context.Context, address string) (map[string]string, error)
+}
+
+// ListChecker is implemented by drivers which can tell, without asking a master server, that
+// listing servers with the given options can't work
+type ListChecker interface {
+	CheckList(opts ListOptions) error
+}
+
+// CheckList returns why the driver can't list servers from a master server with the options, or
+// nil if it may be able to
+func CheckList(d Driver, opts ListOptions) error {
+	if c, ok := d.(ListChecker); ok {
+		return c.CheckList(opts)
 	}
-	chunks := bytes.Split(serverResponse, []byte("\\"))[1:]
-	if len(chunks)%2 != 0 {
-		return nil, fmt.Errorf("malformed server response, key/value length not even")
+	return nil
+}
+
+var drivers = map[string]Driver{
+	"q3":       q3Driver{},
+	"source":   sourceDriver{},
+	"gamespy3": gamespyDriver{},
+	"gamespy4": gamespyDriver{},
+}
+
+// Lookup returns the driver with the given name
+func Lookup(name string) (Driver, error) {
+	if d, present := drivers[name]; present {
+		return d, nil
 	}
+	return nil, fmt.Errorf("unknown protocol %q, expected one of %v", name, Drivers())
+}
 
-	info := map[string]string{}
-	for i := 0; i < len(chunks)-1; i += 2 {
-		info[string(chunks[i])] = string(chunks[i+1])
+// Drivers returns the names of the available drivers
+func Drivers() []string {
+	var names []string
+	for name := range drivers {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	if returnedChallenge, present := info["challenge"]; present {
-		if returnedChallenge != hex {
-			return nil, fmt.Errorf("serverinfo challenge mismatch")
-		}
-	} else {
-		return nil, fmt.Errorf("serverinfo challenge absent")
+// Player is a line of the player list of a server
+type Player struct {
+	// Name is without color codes, which RawName keeps for the protocols which have them
+	Name    string
+	RawName string
+	Score   int
+	Ping    int
+}
+
+// queryTimeout is how long to wait for a reply, unless the context ends earlier. It is a variable
+// so tests can shorten it.
+var queryTimeout = 5 * time.Second
+
+// deadline returns when a reply sent now must have arrived by, queryTimeout from now or the end
+// of the context, whichever comes first
+func deadline(ctx context.Context) time.Time {
+	d := time.Now().Add(queryTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(d) {
+		d = ctxDeadline
 	}
+	return d
+}
 
-	if hostname, present := info["hostname"]; present {
-		info["hostname"] = colorRegex.ReplaceAllString(hostname, "")
+// dial connects to the address, with a deadline of queryTimeout or the end of the context,
+// whichever comes first. The returned function must be called once done with the connection.
+func dial(ctx context.Context, address string) (net.Conn, func(), error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", address)
+	if err != nil {
+		return nil, nil, err
 	}
-	info["ip"] = server
 
-	log.Printf("got server response from server %s", server)
+	conn.SetDeadline(deadline(ctx))
+
+	// unblock reads as soon as the context is cancelled
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
 
-	return info, nil
+	return conn, func() {
+		close(done)
+		conn.Close()
+	}, nil
 }
 
-func sendMessage(address string, message string, expectEot bool) ([]byte, error) {
-	conn, err := net.DialTimeout("udp", address, 5*time.Second)
+// sendMessage sends a connectionless message and returns the reply. If isLast is given, the reply
+// spans several packets, which are read until isLast reports the last one.
+func sendMessage(ctx context.Context, address string, message string, isLast func(packet []byte) bool) ([]byte, error) {
+	conn, closeConn, err := dial(ctx, address)
 	if err != nil {
 		return nil, err
 	}
-	rawMessage := []byte{0xFF, 0xFF, 0xFF, 0xFF}
-	rawMessage = append(rawMessage, message...)
-	conn.Write(rawMessage)
+	defer closeConn()
+
+	rawMessage := append(append([]byte(nil), oobHeader...), message...)
+	if _, err := conn.Write(rawMessage); err != nil {
+		return nil, err
+	}
 
 	response := make([]byte, 8192)
-	reader := bufio.NewReader(conn)
-	read, _ := reader.Read(response)
+	read, err := conn.Read(response)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
 	response = response[:read]
-	if expectEot {
-		for {
-			if bytes.Contains(response, []byte("EOF")) || bytes.Contains(response, []byte("EOT")) {
+	if isLast != nil {
+		packet := response
+		for !isLast(packet) {
+			tmp := make([]byte, 8192)
+			read, err := conn.Read(tmp)
+			if err != nil {
+				// the end of the list got lost or never came, so make do with what was received
 				break
 			}
-			tmp := make([]byte, 8192)
-			read, _ := reader.Read(tmp)
-			tmp = tmp[:read]
-			response = append(response, tmp...)
+			packet = tmp[:read]
+			response = append(response, packet...)
 		}
 	}
 
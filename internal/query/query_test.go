@@ -0,0 +1,53 @@
+package query
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// serveUDP runs a fake game or master server on localhost until the test ends, answering every
+// request with the packets returned by respond, and returns its address
+func serveUDP(t *testing.T, respond func(request []byte) [][]byte) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening for udp: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, packet := range respond(append([]byte(nil), buf[:n]...)) {
+				conn.WriteTo(packet, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// requestFake has a fake server answer a request with the packets, and returns the connection
+// the request was sent on, for the packets to be read from. Reads time out after half a second.
+func requestFake(t *testing.T, packets [][]byte) net.Conn {
+	t.Helper()
+
+	address := serveUDP(t, func([]byte) [][]byte { return packets })
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		t.Fatalf("dialing fake server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(500 * time.Millisecond))
+
+	if _, err := conn.Write([]byte{0}); err != nil {
+		t.Fatalf("writing to fake server: %v", err)
+	}
+	return conn
+}
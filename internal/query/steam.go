@@ -0,0 +1,143 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// steamMasterQuery is the request type of the Steam master server protocol
+	steamMasterQuery = 0x31
+	// steamMaxPages bounds how many pages of servers are requested, each holding up to about 230
+	steamMaxPages = 100
+	// steamFirstSeed asks for the first page of servers, and ends the last page
+	steamFirstSeed = "0.0.0.0:0"
+)
+
+// steamResponseHeader starts every page of servers
+var steamResponseHeader = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x66, 0x0A}
+
+// steamRegions are the region codes of the Steam master server protocol
+var steamRegions = map[string]byte{
+	"us-east":       0x00,
+	"us-west":       0x01,
+	"south-america": 0x02,
+	"europe":        0x03,
+	"asia":          0x04,
+	"australia":     0x05,
+	"middle-east":   0x06,
+	"africa":        0x07,
+	"world":         0xFF,
+}
+
+// steamRegion returns the region code of the named region, the whole world if it is empty
+func steamRegion(name string) (byte, error) {
+	if name == "" {
+		return steamRegions["world"], nil
+	}
+	if code, present := steamRegions[strings.ToLower(name)]; present {
+		return code, nil
+	}
+	return 0, fmt.Errorf("unknown steam region %q", name)
+}
+
+// GetSteamMasterResponse lists the servers matching the filter, e.g. \appid\240, from a Steam
+// master server, paging through the list until its end
+func GetSteamMasterResponse(ctx context.Context, masterServer string, region string, filter string) ([]string, error) {
+	code, err := steamRegion(region)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, closeConn, err := dial(ctx, masterServer)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get response from master server: %v", err)
+	}
+	defer closeConn()
+
+	servers := []string{}
+	seed := steamFirstSeed
+	buf := make([]byte, a2sMaxPacketSize)
+	for page := 0; ; page++ {
+		if page == steamMaxPages {
+			slog.Warn("steam master server listed too many servers, ignoring the rest",
+				"master", masterServer, "servers", len(servers))
+			break
+		}
+
+		request := []byte{steamMasterQuery, code}
+		request = append(request, seed...)
+		request = append(request, 0)
+		request = append(request, filter...)
+		request = append(request, 0)
+
+		// every page gets the full timeout for both sending and reading, as a long list takes many
+		// of them
+		conn.SetDeadline(deadline(ctx))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		_, err := conn.Write(request)
+		var read int
+		if err == nil {
+			read, err = conn.Read(buf)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if len(servers) > 0 {
+				// the rest of the list got lost, so make do with what was received
+				slog.Warn("steam master server stopped responding", "master", masterServer, "err", err)
+				break
+			}
+			return nil, fmt.Errorf("couldn't get response from master server: %v", err)
+		}
+
+		addresses, err := parseSteamPage(buf[:read])
+		if err != nil {
+			return nil, err
+		}
+
+		last := steamFirstSeed
+		for _, address := range addresses {
+			last = address
+			// the seed was listed on the previous page already
+			if address != steamFirstSeed && address != seed {
+				servers = append(servers, address)
+			}
+		}
+		// the list ends with an empty address, or with a page adding nothing new
+		if last == steamFirstSeed || last == seed {
+			break
+		}
+		seed = last
+	}
+
+	slog.Info("master server responded", "master", masterServer, "filter", filter, "servers", len(servers))
+	return servers, nil
+}
+
+// parseSteamPage reads the addresses of a page of servers, each 4 bytes of IPv4 address followed
+// by 2 bytes of big-endian port
+func parseSteamPage(page []byte) ([]string, error) {
+	if !bytes.HasPrefix(page, steamResponseHeader) {
+		return nil, fmt.Errorf("malformed steam master server response")
+	}
+	page = page[len(steamResponseHeader):]
+
+	var addresses []string
+	for ; len(page) >= 6; page = page[6:] {
+		ip := net.IP(page[0:4]).String()
+		port := strconv.Itoa(int(binary.BigEndian.Uint16(page[4:6])))
+		addresses = append(addresses, net.JoinHostPort(ip, port))
+	}
+	return addresses, nil
+}
@@ -0,0 +1,241 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// steamPage builds a page of servers from addresses given as ip:port
+func steamPage(addresses ...string) []byte {
+	page := append([]byte(nil), steamResponseHeader...)
+	for _, address := range addresses {
+		host, port, _ := net.SplitHostPort(address)
+		p, _ := strconv.Atoi(port)
+		page = append(page, net.ParseIP(host).To4()...)
+		page = binary.BigEndian.AppendUint16(page, uint16(p))
+	}
+	return page
+}
+
+// steamAddresses returns n distinct server addresses
+func steamAddresses(n int) []string {
+	var addresses []string
+	for i := 0; i < n; i++ {
+		addresses = append(addresses, fmt.Sprintf("10.0.%d.%d:27015", i/250, i%250+1))
+	}
+	return addresses
+}
+
+// steamRequest is a request of the Steam master server protocol
+type steamRequest struct {
+	region byte
+	seed   string
+	filter string
+}
+
+func parseSteamRequest(b []byte) (steamRequest, bool) {
+	if len(b) < 2 || b[0] != steamMasterQuery {
+		return steamRequest{}, false
+	}
+	fields := bytes.Split(b[2:], []byte{0})
+	if len(fields) != 3 || len(fields[2]) != 0 {
+		return steamRequest{}, false
+	}
+	return steamRequest{region: b[1], seed: string(fields[0]), filter: string(fields[1])}, true
+}
+
+// steamMaster runs a fake Steam master server listing the addresses, pageSize at a time and
+// ending the list with the first seed, and returns its address. Only the first pages pages are
+// answered if pages is positive, and each page is delayed by delay.
+func steamMaster(t *testing.T, addresses []string, pageSize, pages int, delay time.Duration, requests chan<- steamRequest) string {
+	t.Helper()
+
+	answered := 0
+	return serveUDP(t, func(b []byte) [][]byte {
+		request, ok := parseSteamRequest(b)
+		if !ok || (pages > 0 && answered == pages) {
+			return nil
+		}
+		answered++
+		if requests != nil {
+			requests <- request
+		}
+		time.Sleep(delay)
+
+		start := 0
+		for i, address := range addresses {
+			if address == request.seed {
+				start = i + 1
+			}
+		}
+		end := start + pageSize
+		if end >= len(addresses) {
+			return [][]byte{steamPage(append(append([]string(nil), addresses[start:]...), steamFirstSeed)...)}
+		}
+		return [][]byte{steamPage(addresses[start:end]...)}
+	})
+}
+
+// shortenQueryTimeout lowers queryTimeout for the rest of the test
+func shortenQueryTimeout(t *testing.T, timeout time.Duration) {
+	previous := queryTimeout
+	queryTimeout = timeout
+	t.Cleanup(func() { queryTimeout = previous })
+}
+
+func TestParseSteamPage(t *testing.T) {
+	tests := []struct {
+		name string
+		page []byte
+		want []string
+	}{
+		{"empty", steamPage(), nil},
+		{"addresses", steamPage("1.2.3.4:27015", "5.6.7.8:65535"), []string{"1.2.3.4:27015", "5.6.7.8:65535"}},
+		{"end of list", steamPage("1.2.3.4:27015", steamFirstSeed), []string{"1.2.3.4:27015", steamFirstSeed}},
+		{"truncated address", steamPage("1.2.3.4:27015", "5.6.7.8:27015")[:len(steamResponseHeader)+10], []string{"1.2.3.4:27015"}},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSteamPage(tt.page)
+		if err != nil {
+			t.Errorf("%s: parseSteamPage() returned error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseSteamPage() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := parseSteamPage([]byte("\xff\xff\xff\xff\x66\x0b")); err == nil {
+		t.Errorf("parseSteamPage() of a page with the wrong header returned no error")
+	}
+}
+
+func TestSteamRegion(t *testing.T) {
+	tests := []struct {
+		name string
+		want byte
+		err  bool
+	}{
+		{"", 0xFF, false},
+		{"world", 0xFF, false},
+		{"us-east", 0x00, false},
+		{"Europe", 0x03, false},
+		{"africa", 0x07, false},
+		{"atlantis", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := steamRegion(tt.name)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("steamRegion(%q) = %d, %v, want %d and error %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestGetSteamMasterResponse(t *testing.T) {
+	addresses := steamAddresses(25)
+	requests := make(chan steamRequest, 10)
+	master := steamMaster(t, addresses, 10, 0, 0, requests)
+
+	servers, err := GetSteamMasterResponse(context.Background(), master, "europe", `\appid\240`)
+	if err != nil {
+		t.Fatalf("GetSteamMasterResponse() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(servers, addresses) {
+		t.Errorf("GetSteamMasterResponse() = %v, want %v", servers, addresses)
+	}
+
+	var seeds []string
+	for i := 0; i < 3; i++ {
+		request := <-requests
+		if request.region != steamRegions["europe"] || request.filter != `\appid\240` {
+			t.Errorf("master got request %+v, want region europe and the filter", request)
+		}
+		seeds = append(seeds, request.seed)
+	}
+	if want := []string{steamFirstSeed, addresses[9], addresses[19]}; !reflect.DeepEqual(seeds, want) {
+		t.Errorf("master got seeds %v, want %v", seeds, want)
+	}
+}
+
+func TestGetSteamMasterResponseEnds(t *testing.T) {
+	shortenQueryTimeout(t, 200*time.Millisecond)
+
+	tests := []struct {
+		name   string
+		master func(t *testing.T) string
+		want   []string
+	}{
+		{
+			name: "page adding nothing new",
+			master: func(t *testing.T) string {
+				return serveUDP(t, func(b []byte) [][]byte {
+					if request, _ := parseSteamRequest(b); request.seed == "1.2.3.4:27015" {
+						return [][]byte{steamPage("1.2.3.4:27015")}
+					}
+					return [][]byte{steamPage("5.6.7.8:27015", "1.2.3.4:27015")}
+				})
+			},
+			want: []string{"5.6.7.8:27015", "1.2.3.4:27015"},
+		},
+		{
+			name: "too many pages",
+			master: func(t *testing.T) string {
+				return steamMaster(t, steamAddresses(steamMaxPages+5), 1, 0, 0, nil)
+			},
+			want: steamAddresses(steamMaxPages),
+		},
+		{
+			name: "master stopping to respond",
+			master: func(t *testing.T) string {
+				return steamMaster(t, steamAddresses(30), 10, 2, 0, nil)
+			},
+			want: steamAddresses(20),
+		},
+		{
+			name: "list taking longer than the query timeout",
+			master: func(t *testing.T) string {
+				return steamMaster(t, steamAddresses(50), 10, 0, 80*time.Millisecond, nil)
+			},
+			want: steamAddresses(50),
+		},
+	}
+
+	for _, tt := range tests {
+		servers, err := GetSteamMasterResponse(context.Background(), tt.master(t), "", `\gamedir\cstrike`)
+		if err != nil {
+			t.Errorf("%s: GetSteamMasterResponse() returned error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(servers, tt.want) {
+			t.Errorf("%s: GetSteamMasterResponse() = %v, want %v", tt.name, servers, tt.want)
+		}
+	}
+}
+
+func TestGetSteamMasterResponseErrors(t *testing.T) {
+	shortenQueryTimeout(t, 200*time.Millisecond)
+	master := steamMaster(t, steamAddresses(5), 10, 0, 0, nil)
+
+	if _, err := GetSteamMasterResponse(context.Background(), master, "atlantis", ""); err == nil {
+		t.Errorf("GetSteamMasterResponse() with an unknown region returned no error")
+	}
+
+	silent := serveUDP(t, func([]byte) [][]byte { return nil })
+	if _, err := GetSteamMasterResponse(context.Background(), silent, "", ""); err == nil {
+		t.Errorf("GetSteamMasterResponse() from a master which never responds returned no error")
+	}
+
+	garbled := serveUDP(t, func([]byte) [][]byte { return [][]byte{[]byte("garbage")} })
+	if _, err := GetSteamMasterResponse(context.Background(), garbled, "", ""); err == nil {
+		t.Errorf("GetSteamMasterResponse() from a master sending garbage returned no error")
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/api"
+)
+
+// maxChoiceLength is the longest name or value discord accepts for an autocomplete choice
+const maxChoiceLength = 100
+
+// GameIds returns the ids of the enabled games in the current config
+func (srv *Server) GameIds() []string {
+	var ids []string
+	for _, m := range srv.Masters() {
+		if !m.Disabled {
+			ids = append(ids, m.GameId)
+		}
+	}
+	return ids
+}
+
+// Servers returns a copy of the cached servers for the given game
+func (srv *Server) Servers(gameId string) (servers []GameServer, present bool) {
+	srv.gameServersWriteMutex.Lock()
+	defer srv.gameServersWriteMutex.Unlock()
+
+	cached, present := srv.GameServers[gameId]
+	return append([]GameServer(nil), cached...), present
+}
+
+// AllServers returns a copy of the cached servers for every game
+func (srv *Server) AllServers() (servers []GameServer) {
+	srv.gameServersWriteMutex.Lock()
+	defer srv.gameServersWriteMutex.Unlock()
+
+	for _, v := range srv.GameServers {
+		servers = append(servers, v...)
+	}
+	return
+}
+
+// GameChoices suggests the configured games containing the typed text
+func (srv *Server) GameChoices(typed string) []api.AutocompleteChoice {
+	choices := []api.AutocompleteChoice{}
+	for _, id := range srv.GameIds() {
+		if strings.Contains(strings.ToLower(id), strings.ToLower(typed)) {
+			choices = append(choices, api.AutocompleteChoice{Name: id, Value: id})
+		}
+	}
+	return choices
+}
+
+// HostnameChoices suggests the hostnames of cached servers containing the typed text
+func (srv *Server) HostnameChoices(typed string) []api.AutocompleteChoice {
+	seen := make(map[string]bool)
+	var hostnames []string
+	for _, s := range srv.AllServers() {
+		hostname := strings.TrimSpace(s["hostname"])
+		if r := []rune(hostname); len(r) > maxChoiceLength {
+			hostname = string(r[:maxChoiceLength])
+		}
+
+		if hostname == "" || seen[hostname] {
+			continue
+		}
+
+		if strings.Contains(strings.ToLower(hostname), strings.ToLower(typed)) {
+			seen[hostname] = true
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	sort.Strings(hostnames)
+
+	choices := []api.AutocompleteChoice{}
+	for _, hostname := range hostnames {
+		choices = append(choices, api.AutocompleteChoice{Name: hostname, Value: hostname})
+	}
+	return choices
+}
@@ -1,66 +1,352 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/trondhumbor/pigeon/internal/query"
 )
 
-func (srv *Server) PopulateGameServers() {
+// maxConcurrentQueries bounds how many game servers are queried at the same time
+const maxConcurrentQueries = 256
 
-	querySingleServer := func(gameServer string, gameId string) {
-		info, err := query.GetSingleServerResponse(gameServer)
-		if err != nil {
-			return
+// AllEndpoints returns every endpoint of the master server without duplicates, Endpoint first
+func (m MasterServer) AllEndpoints() []string {
+	seen := make(map[string]bool)
+	endpoints := []string{}
+	for _, e := range append([]string{m.Endpoint}, m.Endpoints...) {
+		if e == "" || seen[e] {
+			continue
 		}
+		seen[e] = true
+		endpoints = append(endpoints, e)
+	}
+	return endpoints
+}
 
-		if val, present := info["gamename"]; present {
-			if !strings.EqualFold(val, gameId) { // if server is not actually of the game we want
-				return
+// snapshot is the result of a refresh of a single game, swapped into the cache once complete
+type snapshot struct {
+	servers  []GameServer
+	excluded map[string]int
+	mutex    sync.Mutex
+}
+
+func (s *snapshot) exclude(reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.excluded[reason]++
+}
+
+func (s *snapshot) add(info GameServer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.servers = append(s.servers, info)
+}
+
+// querySingleServer queries a game server and adds it to the snapshot if it should be listed.
+// It returns false if the server didn't respond.
+func (srv *Server) querySingleServer(
+	ctx context.Context, driver query.Driver, gameServer string, master MasterServer, snap *snapshot,
+) bool {
+	gameId := master.GameId
+	blocklist, allowlist := srv.AddressLists()
+
+	allowed := allowlist.Contains(gameServer)
+	if !allowed && blocklist.Contains(gameServer) {
+		snap.exclude(ReasonBlocked)
+		return true
+	}
+
+	info, err := driver.Info(ctx, gameServer)
+	if err != nil {
+		return false
+	}
+	info[KeyLastSeen] = strconv.FormatInt(time.Now().Unix(), 10)
+
+	if val, present := info["gamename"]; present {
+		if !strings.EqualFold(val, gameId) { // if server is not actually of the game we want
+			return true
+		}
+	} else {
+		return true // if gamename key isn't present
+	}
+
+	reason := master.EffectiveLimits().Check(info)
+	if reason == "" && !allowed {
+		reason = srv.detectFake(ctx, driver, gameServer, info, master.Detection)
+	}
+
+	if reason != "" {
+		slog.Debug("excluded server", "gameId", gameId, "server", gameServer, "reason", reason)
+		snap.exclude(reason)
+		return true
+	}
+
+	snap.add(info)
+	return true
+}
+
+// queryServers queries the game servers in parallel, and returns the ones which didn't respond
+func (srv *Server) queryServers(
+	ctx context.Context, driver query.Driver, servers []string, master MasterServer, snap *snapshot,
+) []string {
+	var missed []string
+	var missedMutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		server := server
+		select {
+		case srv.querySlots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		}
+
+		wg.Add(1)
+		srv.tasks.Go("query server", func() {
+			defer func() { <-srv.querySlots }()
+			defer wg.Done()
+			if !srv.querySingleServer(ctx, driver, server, master, snap) {
+				missedMutex.Lock()
+				missed = append(missed, server)
+				missedMutex.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	return missed
+}
+
+// queryMasters queries every endpoint of the master server in parallel, and merges their lists.
+// It only fails if none of the endpoints responded.
+func (srv *Server) queryMasters(
+	ctx context.Context, driver query.Driver, master MasterServer, endpoints []string,
+) ([]string, error) {
+	lists := make([][]string, len(endpoints))
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		i, endpoint := i, endpoint
+		wg.Add(1)
+		srv.tasks.Go("query master", func() {
+			defer wg.Done()
+			lists[i], errs[i] = driver.ListServers(ctx, endpoint, master.ListOptions())
+		})
+	}
+	wg.Wait()
+
+	var servers []string
+	responded := false
+	for i := range endpoints {
+		if errs[i] != nil {
+			continue
+		}
+		responded = true
+		servers = append(servers, lists[i]...)
+	}
+
+	if !responded {
+		return nil, fmt.Errorf("none of the %d master endpoints responded: %v", len(endpoints), errors.Join(errs...))
+	}
+	return servers, nil
+}
+
+// listServers returns the addresses of the game's servers, as listed by its master servers, its
+// static servers, its server list URL and LAN discovery, without duplicates. The error is about the master
+// servers only, the other sources are listed regardless of it.
+func (srv *Server) listServers(ctx context.Context, driver query.Driver, master MasterServer) ([]string, error) {
+	var listed []string
+	var err error
+	if endpoints := master.AllEndpoints(); len(endpoints) > 0 {
+		listed, err = srv.queryMasters(ctx, driver, master, endpoints)
+	}
+
+	listed = append(listed, master.Servers...)
+
+	if master.ServerListURL != "" {
+		fetched, ferr := fetchServerList(ctx, master.ServerListURL)
+		if ferr != nil {
+			slog.Warn("couldn't fetch server list", "gameId", master.GameId, "url", master.ServerListURL, "err", ferr)
+		}
+		listed = append(listed, fetched...)
+	}
+
+	if master.LAN != nil {
+		listed = append(listed, srv.discoverLAN(ctx, driver, master)...)
+	}
+
+	seen := make(map[string]bool, len(listed))
+	servers := []string{}
+	for _, server := range listed {
+		if !seen[server] {
+			seen[server] = true
+			servers = append(servers, server)
+		}
+	}
+	return servers, err
+}
+
+// discoverLAN returns the addresses of the servers which replied to a broadcast on the game's
+// local networks. They are queried again like any other server, so they are checked the same way.
+func (srv *Server) discoverLAN(ctx context.Context, driver query.Driver, master MasterServer) []string {
+	discoverer, ok := driver.(query.LANDiscoverer)
+	if !ok {
+		slog.Warn("lan discovery isn't supported by the protocol", "gameId", master.GameId, "protocol", master.Protocol)
+		return nil
+	}
+
+	broadcasts, err := master.LAN.broadcastAddresses()
+	if err != nil {
+		slog.Warn("couldn't discover lan servers", "gameId", master.GameId, "err", err)
+		return nil
+	}
+
+	discovered, err := discoverer.DiscoverLAN(ctx, broadcasts, master.LAN.wait())
+	if err != nil {
+		slog.Warn("couldn't discover lan servers", "gameId", master.GameId, "err", err)
+		return nil
+	}
+
+	var servers []string
+	for address := range discovered {
+		servers = append(servers, address)
+	}
+	return servers
+}
+
+// refreshGame queries the servers of a single game, and replaces its cached servers with the result.
+// When no master server responds, the servers which were listed before are queried instead of being
+// dropped. Those which don't respond are retried, and kept with their previous info until they have
+// missed too many refreshes in a row.
+func (srv *Server) refreshGame(ctx context.Context, master MasterServer) {
+	driver, err := master.Driver()
+	if err != nil {
+		srv.recordMasterResult(master.GameId, err)
+		slog.Error("couldn't refresh game", "gameId", master.GameId, "err", err)
+		return
+	}
+
+	listed, err := srv.listServers(ctx, driver, master)
+	srv.recordMasterResult(master.GameId, err)
+	if err != nil {
+		slog.Warn("no master server responded, only querying other known servers", "gameId", master.GameId, "err", err)
+	}
+
+	cached, _ := srv.Servers(master.GameId)
+	previous := make(map[string]GameServer, len(cached))
+	for _, info := range cached {
+		previous[info["ip"]] = info
+	}
+
+	servers := listed
+	// servers which are no longer listed by a responding master were delisted or removed
+	if err != nil {
+		seen := make(map[string]bool, len(listed))
+		for _, server := range listed {
+			seen[server] = true
+		}
+		for _, info := range cached {
+			if !seen[info["ip"]] {
+				seen[info["ip"]] = true
+				servers = append(servers, info["ip"])
 			}
-		} else {
-			return // if gamename key isn't present
 		}
+	}
 
-		srv.gameServersWriteMutex.Lock()
-		srv.GameServers[gameId] = append(srv.GameServers[gameId], info)
-		srv.gameServersWriteMutex.Unlock()
+	snap := &snapshot{servers: []GameServer{}, excluded: make(map[string]int)}
+	retention := master.Retention
+	missed := srv.queryServers(ctx, driver, servers, master, snap)
+	for retry := 0; retry < retention.retries() && len(missed) > 0; retry++ {
+		select {
+		case <-time.After(retention.retryDelay()):
+		case <-ctx.Done():
+			return
+		}
+		slog.Debug("retrying servers which didn't respond", "gameId", master.GameId, "servers", len(missed))
+		missed = srv.queryServers(ctx, driver, missed, master, snap)
 	}
 
-	query := func(master MasterServer) {
-		servers := query.GetMasterServerResponse(master.Endpoint, master.GameId, master.Protocol)
+	// a refresh cut short by shutdown is incomplete, and shouldn't replace the previous one
+	if ctx.Err() != nil {
+		return
+	}
 
-		for _, server := range servers {
-			go querySingleServer(server, master.GameId)
+	for _, server := range missed {
+		if info, present := previous[server]; present {
+			if retained, ok := retention.retain(info); ok {
+				snap.add(retained)
+			}
 		}
 	}
 
-	populate := func() {
-		// create the initial slices
-		for _, m := range srv.MasterServers {
-			srv.gameServersWriteMutex.Lock()
+	srv.gameServersWriteMutex.Lock()
+	defer srv.gameServersWriteMutex.Unlock()
+
+	// the master may have been removed or disabled while the servers were queried
+	if _, present := srv.GameServers[master.GameId]; !present {
+		return
+	}
+	srv.GameServers[master.GameId] = snap.servers
+	srv.excluded[master.GameId] = snap.excluded
+}
+
+// Refresh queries every enabled master server again, replacing the cached servers of each game
+// once all of them have been queried. The queries are cancelled when the server shuts down.
+func (srv *Server) Refresh() {
+	ctx := srv.ctx
+	if ctx.Err() != nil {
+		return
+	}
+	masters := srv.Masters()
+
+	// create the initial slices of games which haven't been cached yet
+	srv.gameServersWriteMutex.Lock()
+	for _, m := range masters {
+		if m.Disabled {
+			continue
+		}
+		if _, present := srv.GameServers[m.GameId]; !present {
 			srv.GameServers[m.GameId] = []GameServer{}
-			srv.gameServersWriteMutex.Unlock()
+			srv.excluded[m.GameId] = make(map[string]int)
 		}
+	}
+	srv.lastRefresh = time.Now()
+	srv.gameServersWriteMutex.Unlock()
+
+	srv.pruneCountHistory()
 
-		for _, m := range srv.MasterServers {
-			go query(m)
+	for _, m := range masters {
+		if m.Disabled {
+			continue
 		}
+		m := m
+		srv.tasks.Go("refresh game", func() { srv.refreshGame(ctx, m) })
 	}
+}
 
+// PopulateGameServers fills the cache, and keeps refreshing it until the context ends
+func (srv *Server) PopulateGameServers(ctx context.Context) {
 	// fill the cache initially
-	populate()
+	srv.Refresh()
 
 	// refresh it every 3 minutes
 	tickRate := 3 * time.Minute
 	ticker := time.NewTicker(tickRate)
-	go func() {
+	srv.tasks.Go("refresh loop", func() {
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				populate()
+				srv.tasks.Run("refresh", srv.Refresh)
+			case <-ctx.Done():
+				return
 			}
 		}
-	}()
+	})
 }
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The config can be changed at runtime by the admin commands. Slices and maps in it are never
+// modified in place, but replaced under configMutex, so the values returned by the accessors
+// below can be read without holding the lock.
+
+// Masters returns the configured master servers, including disabled ones
+func (srv *Server) Masters() []MasterServer {
+	srv.configMutex.RLock()
+	defer srv.configMutex.RUnlock()
+	return srv.MasterServers
+}
+
+// Aliases returns the configured mapname and gametype aliases
+func (srv *Server) Aliases() (mapnames, gametypes map[string]string) {
+	srv.configMutex.RLock()
+	defer srv.configMutex.RUnlock()
+	return srv.Mapnames, srv.Gametypes
+}
+
+// AddressLists returns the configured blocklist and allowlist
+func (srv *Server) AddressLists() (blocklist, allowlist AddressList) {
+	srv.configMutex.RLock()
+	defer srv.configMutex.RUnlock()
+	return srv.Blocklist, srv.Allowlist
+}
+
+// AddMaster adds a master server to the config. If the game already has one, only its endpoints,
+// protocol, version and IPv6 setting are replaced, keeping the rest of its config.
+func (srv *Server) AddMaster(master MasterServer) error {
+	srv.configMutex.Lock()
+	masters := append([]MasterServer(nil), srv.MasterServers...)
+	found := false
+	for i := range masters {
+		if strings.EqualFold(masters[i].GameId, master.GameId) {
+			masters[i].Protocol = master.Protocol
+			masters[i].Version = master.Version
+			masters[i].Endpoint = master.Endpoint
+			masters[i].Endpoints = master.Endpoints
+			masters[i].IPv6 = master.IPv6
+			found = true
+		}
+	}
+	if !found {
+		masters = append(masters, master)
+	}
+	srv.MasterServers = masters
+	srv.configMutex.Unlock()
+
+	return srv.SaveConfig()
+}
+
+// RemoveMaster removes the master server of the given game from the config and drops its servers from the cache
+func (srv *Server) RemoveMaster(gameId string) error {
+	srv.configMutex.Lock()
+	masters := []MasterServer{}
+	removed := ""
+	for _, m := range srv.MasterServers {
+		if strings.EqualFold(m.GameId, gameId) {
+			removed = m.GameId
+			continue
+		}
+		masters = append(masters, m)
+	}
+	srv.MasterServers = masters
+	srv.configMutex.Unlock()
+
+	if removed == "" {
+		return fmt.Errorf("no master server configured for %q", gameId)
+	}
+
+	srv.forgetGame(removed)
+	return srv.SaveConfig()
+}
+
+// SetMasterDisabled disables or enables querying the master server of the given game
+func (srv *Server) SetMasterDisabled(gameId string, disabled bool) error {
+	srv.configMutex.Lock()
+	masters := append([]MasterServer(nil), srv.MasterServers...)
+	matched := ""
+	for i := range masters {
+		if strings.EqualFold(masters[i].GameId, gameId) {
+			masters[i].Disabled = disabled
+			matched = masters[i].GameId
+		}
+	}
+	srv.MasterServers = masters
+	srv.configMutex.Unlock()
+
+	if matched == "" {
+		return fmt.Errorf("no master server configured for %q", gameId)
+	}
+
+	if disabled {
+		srv.forgetGame(matched)
+	}
+	return srv.SaveConfig()
+}
+
+// forgetGame drops the cached servers and query outcomes of the game, which must be given as
+// configured, as the cache is keyed by the exact game id
+func (srv *Server) forgetGame(gameId string) {
+	srv.gameServersWriteMutex.Lock()
+	defer srv.gameServersWriteMutex.Unlock()
+
+	delete(srv.GameServers, gameId)
+	delete(srv.excluded, gameId)
+	delete(srv.masterStatus, gameId)
+}
+
+func withEntry(m map[string]string, key, value string) map[string]string {
+	ret := make(map[string]string, len(m)+1)
+	for k, v := range m {
+		ret[k] = v
+	}
+	ret[key] = value
+	return ret
+}
+
+// AddMapnameAlias sets the name shown for the given mapname
+func (srv *Server) AddMapnameAlias(mapname, alias string) error {
+	srv.configMutex.Lock()
+	srv.Mapnames = withEntry(srv.Mapnames, mapname, alias)
+	srv.configMutex.Unlock()
+
+	return srv.SaveConfig()
+}
+
+// AddGametypeAlias sets the name shown for the given gametype
+func (srv *Server) AddGametypeAlias(gametype, alias string) error {
+	srv.configMutex.Lock()
+	srv.Gametypes = withEntry(srv.Gametypes, gametype, alias)
+	srv.configMutex.Unlock()
+
+	return srv.SaveConfig()
+}
+
+// AddToBlocklist adds an address or CIDR range to the blocklist
+func (srv *Server) AddToBlocklist(entry string) error {
+	srv.configMutex.Lock()
+	for _, e := range srv.Blocklist {
+		if e == entry {
+			srv.configMutex.Unlock()
+			return fmt.Errorf("%q is already blocklisted", entry)
+		}
+	}
+	srv.Blocklist = append(append(AddressList(nil), srv.Blocklist...), entry)
+	srv.configMutex.Unlock()
+
+	return srv.SaveConfig()
+}
+
+// RemoveFromBlocklist removes an address or CIDR range from the blocklist
+func (srv *Server) RemoveFromBlocklist(entry string) error {
+	srv.configMutex.Lock()
+	blocklist := AddressList{}
+	found := false
+	for _, e := range srv.Blocklist {
+		if e == entry {
+			found = true
+			continue
+		}
+		blocklist = append(blocklist, e)
+	}
+	srv.Blocklist = blocklist
+	srv.configMutex.Unlock()
+
+	if !found {
+		return fmt.Errorf("%q is not blocklisted", entry)
+	}
+
+	return srv.SaveConfig()
+}
+
+// SaveConfig writes the current config back to the file it was read from
+func (srv *Server) SaveConfig() error {
+	srv.configMutex.RLock()
+	b, err := json.MarshalIndent(srv, "", "  ")
+	srv.configMutex.RUnlock()
+	if err != nil {
+		return fmt.Errorf("marshalling config: %v", err)
+	}
+
+	// write to a temporary file first, so a failed write can't leave a truncated config behind
+	tmp, err := ioutil.TempFile(filepath.Dir(srv.configPath), filepath.Base(srv.configPath)+".*")
+	if err != nil {
+		return fmt.Errorf("creating temporary config file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing config: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing config: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), srv.configPath); err != nil {
+		return fmt.Errorf("replacing config: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// Cooldown is how long a command can't be used again after being used
+type Cooldown struct {
+	// User is the cooldown for the member who used the command
+	User Duration `json:"user,omitempty"`
+	// Channel is the cooldown for everyone in the channel the command was used in
+	Channel Duration `json:"channel,omitempty"`
+}
+
+// commandCooldown returns the configured cooldown of the command with the given name
+func (srv *Server) commandCooldown(name string) Cooldown {
+	srv.configMutex.RLock()
+	defer srv.configMutex.RUnlock()
+	return srv.Cooldowns[name]
+}
+
+// checkCooldown returns how long the sender of the interaction has to wait before using the
+// command with the given name, or 0 if they can use it now, in which case the cooldowns start
+func (srv *Server) checkCooldown(event *gateway.InteractionCreateEvent, name string) time.Duration {
+	cooldown := srv.commandCooldown(name)
+	if cooldown.User.Duration <= 0 && cooldown.Channel.Duration <= 0 {
+		return 0
+	}
+
+	userKey := fmt.Sprintf("%s/user/%s", name, event.SenderID())
+	channelKey := fmt.Sprintf("%s/channel/%s", name, event.ChannelID)
+	now := time.Now()
+
+	srv.cooldownMutex.Lock()
+	defer srv.cooldownMutex.Unlock()
+
+	for key, until := range srv.cooldowns {
+		if now.After(until) {
+			delete(srv.cooldowns, key)
+		}
+	}
+
+	var wait time.Duration
+	for _, key := range []string{userKey, channelKey} {
+		if until, present := srv.cooldowns[key]; present && until.Sub(now) > wait {
+			wait = until.Sub(now)
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	if cooldown.User.Duration > 0 {
+		srv.cooldowns[userKey] = now.Add(cooldown.User.Duration)
+	}
+	if cooldown.Channel.Duration > 0 {
+		srv.cooldowns[channelKey] = now.Add(cooldown.Channel.Duration)
+	}
+	return 0
+}
+
+// enforceCooldown tells the sender of the interaction to wait if the command with the given name
+// is on cooldown for them. It returns whether handling should continue.
+func (srv *Server) enforceCooldown(event *gateway.InteractionCreateEvent, name string) bool {
+	wait := srv.checkCooldown(event, name)
+	if wait <= 0 {
+		return true
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	srv.respondEphemeral(event, fmt.Sprintf("this command is on cooldown, try again in %ds.", seconds))
+	return false
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trondhumbor/pigeon/internal/query"
+)
+
+// The reasons a server can be flagged as fake for
+const (
+	ReasonBlocked            = "blocklisted"
+	ReasonPlayerListMismatch = "client count not matching player list"
+	ReasonConstantCounts     = "player counts constant for too long"
+)
+
+// countHistoryHorizon is how long the player counts of a server which stopped responding are kept,
+// so the history doesn't grow forever as servers come and go
+const countHistoryHorizon = 24 * time.Hour
+
+// statusTolerance is how far the client count of the info may be off from the player list,
+// as players may join or leave between the two queries
+const statusTolerance = 1
+
+// Detection configures the heuristics used to flag servers advertising fake information
+type Detection struct {
+	// CheckStatus cross-checks the client count of the info against the player list, such as
+	// getinfo against getstatus for Quake 3
+	CheckStatus bool `json:"checkStatus,omitempty"`
+	// ConstantFor flags non-empty servers whose player counts haven't changed for this long, 0 disables it
+	ConstantFor Duration `json:"constantFor,omitempty"`
+}
+
+// AddressList is a list of server addresses, either as an IP, an IP and port, or a CIDR range
+type AddressList []string
+
+// Contains reports whether the server address, given as ip:port, is in the list
+func (l AddressList) Contains(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+
+	for _, entry := range l {
+		// an IPv6 address may be written in brackets without a port
+		if entry == address || strings.TrimSuffix(strings.TrimPrefix(entry, "["), "]") == host {
+			return true
+		}
+
+		if _, network, err := net.ParseCIDR(entry); err == nil && ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type countRecord struct {
+	counts string
+	since  time.Time
+	// seen is when the counts were last recorded
+	seen time.Time
+}
+
+// detectFake runs the configured heuristics against a server which responded to an info query, and
+// returns the reason it looks fake, or an empty string if it doesn't
+func (srv *Server) detectFake(
+	ctx context.Context, driver query.Driver, address string, info GameServer, d Detection,
+) string {
+	if d.ConstantFor.Duration > 0 && srv.countsConstantFor(address, info) > d.ConstantFor.Duration {
+		return ReasonConstantCounts
+	}
+
+	if d.CheckStatus {
+		players, err := driver.Players(ctx, address)
+		if err != nil {
+			// an unanswered getstatus is most likely packet loss, so it isn't held against the server
+			return ""
+		}
+
+		clients, _ := strconv.Atoi(info["clients"])
+		maxclients, _ := strconv.Atoi(info["sv_maxclients"])
+		diff := clients - len(players)
+		if diff < -statusTolerance || diff > statusTolerance || len(players) > maxclients {
+			return ReasonPlayerListMismatch
+		}
+	}
+
+	return ""
+}
+
+// countsConstantFor records the player counts of a server, and returns how long they have been
+// unchanged. Servers without human players are never considered constant, as idle servers and
+// servers full of bots keep their counts for long.
+func (srv *Server) countsConstantFor(address string, info GameServer) time.Duration {
+	counts := info["clients"] + "/" + info["bots"]
+	clients, _ := strconv.Atoi(info["clients"])
+	bots, _ := strconv.Atoi(info["bots"])
+	now := time.Now()
+
+	srv.countHistoryMutex.Lock()
+	defer srv.countHistoryMutex.Unlock()
+
+	record, present := srv.countHistory[address]
+	if !present || record.counts != counts || clients-bots <= 0 {
+		srv.countHistory[address] = countRecord{counts: counts, since: now, seen: now}
+		return 0
+	}
+
+	record.seen = now
+	srv.countHistory[address] = record
+	return now.Sub(record.since)
+}
+
+// pruneCountHistory forgets the player counts of servers not seen within countHistoryHorizon
+func (srv *Server) pruneCountHistory() {
+	cutoff := time.Now().Add(-countHistoryHorizon)
+
+	srv.countHistoryMutex.Lock()
+	defer srv.countHistoryMutex.Unlock()
+
+	for address, record := range srv.countHistory {
+		if record.seen.Before(cutoff) {
+			delete(srv.countHistory, address)
+		}
+	}
+}
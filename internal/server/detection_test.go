@@ -0,0 +1,63 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddressListContains(t *testing.T) {
+	list := AddressList{"1.2.3.4", "5.6.7.8:27960", "10.0.0.0/8", "2001:db8::1", "[2001:db8::2]:27960", "[2001:db8::3]", "fd00::/8"}
+
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"1.2.3.4:27960", true},
+		{"1.2.3.4:27961", true},
+		{"1.2.3.5:27960", false},
+		{"5.6.7.8:27960", true},
+		{"5.6.7.8:27961", false},
+		{"10.20.30.40:27960", true},
+		{"11.0.0.1:27960", false},
+		{"[2001:db8::1]:27960", true},
+		{"[2001:db8::2]:27960", true},
+		{"[2001:db8::2]:27961", false},
+		{"[2001:db8::3]:27960", true},
+		{"[2001:db8::4]:27960", false},
+		{"[fd12::1]:27960", true},
+		{"1.2.3.4", true},
+	}
+
+	for _, tt := range tests {
+		if got := list.Contains(tt.address); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestCountsConstantFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     GameServer
+		constant bool
+	}{
+		{"humans", GameServer{"clients": "6", "bots": "2"}, true},
+		{"humans without bots reported", GameServer{"clients": "6"}, true},
+		{"empty", GameServer{"clients": "0", "bots": "0"}, false},
+		{"only bots", GameServer{"clients": "4", "bots": "4"}, false},
+		{"more bots than clients", GameServer{"clients": "2", "bots": "4"}, false},
+	}
+
+	for _, tt := range tests {
+		srv := &Server{countHistory: make(map[string]countRecord)}
+		srv.countsConstantFor("1.2.3.4:27960", tt.info)
+		// pretend the counts were first recorded an hour ago
+		record := srv.countHistory["1.2.3.4:27960"]
+		record.since = record.since.Add(-time.Hour)
+		srv.countHistory["1.2.3.4:27960"] = record
+
+		if got := srv.countsConstantFor("1.2.3.4:27960", tt.info); (got >= time.Hour) != tt.constant {
+			t.Errorf("%s: countsConstantFor() = %v, want constant %v", tt.name, got, tt.constant)
+		}
+	}
+}
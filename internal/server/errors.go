@@ -0,0 +1,73 @@
+package server
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/trondhumbor/pigeon/internal/supervisor"
+)
+
+// newCorrelationID returns a short random id tying the message shown to a user to the logged error
+func newCorrelationID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+// interactionLogger returns a logger annotated with the command, guild and user of the interaction
+func interactionLogger(event *gateway.InteractionCreateEvent, name string) *slog.Logger {
+	return slog.With("command", name, "guild", event.GuildID, "user", event.SenderID())
+}
+
+// reportError handles an error which occurred while handling an interaction for the command with
+// the given name. The sender gets a friendly message, while the full error is logged and
+// forwarded to the admin log channel if one is configured.
+func (srv *Server) reportError(event *gateway.InteractionCreateEvent, name string, err error) {
+	id := newCorrelationID()
+	interactionLogger(event, name).Error("error occurred handling interaction", "errorId", id, "err", err)
+
+	srv.respondEphemeral(event, fmt.Sprintf(
+		"something went wrong handling /%s, please try again later. (error id: %s)", name, id))
+
+	details := fmt.Sprintf("%v", err)
+	var perr *supervisor.PanicError
+	if errors.As(err, &perr) {
+		details += "\n\n" + string(perr.Stack)
+	}
+
+	srv.forwardToAdminLog(id, fmt.Sprintf("error `%s` handling /%s for <@%s> in <#%s>:", id, name, event.SenderID(), event.ChannelID), details)
+}
+
+// reportPanic forwards a panic recovered from a background task to the admin log channel
+func (srv *Server) reportPanic(perr *supervisor.PanicError) {
+	id := newCorrelationID()
+	slog.Error("background task panicked", "errorId", id, "task", perr.Task, "err", perr)
+
+	srv.forwardToAdminLog(id, fmt.Sprintf("error `%s`, background task %s panicked:", id, perr.Task),
+		fmt.Sprintf("%v\n\n%s", perr.Recovered, perr.Stack))
+}
+
+// forwardToAdminLog sends the heading followed by the details in a code block to the admin log channel,
+// if one is configured
+func (srv *Server) forwardToAdminLog(id, heading, details string) {
+	srv.configMutex.RLock()
+	channelID := srv.AdminLogChannel
+	srv.configMutex.RUnlock()
+
+	if !channelID.IsValid() || srv.Session == nil {
+		return
+	}
+
+	// keep the message within the discord char limit
+	if max := 2000 - len(heading) - len("\n```\n\n```"); len(details) > max {
+		details = details[:max]
+	}
+
+	message := fmt.Sprintf("%s\n```\n%s\n```", heading, details)
+	if _, mErr := srv.Session.SendMessage(channelID, message); mErr != nil {
+		slog.Error("error occurred forwarding error to the admin log channel", "errorId", id, "err", mErr)
+	}
+}
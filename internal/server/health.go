@@ -0,0 +1,125 @@
+package server
+
+import (
+	"runtime"
+	"time"
+)
+
+// gatewayTimeout is how long the gateway may go without acknowledging a heartbeat before it is
+// considered disconnected. Discord asks for a heartbeat about every 41 seconds.
+const gatewayTimeout = 2 * time.Minute
+
+// masterStatus is the outcome of the recent queries of a master server
+type masterStatus struct {
+	lastSuccess time.Time
+	lastError   error
+}
+
+// GameHealth is the cache state of a single game
+type GameHealth struct {
+	GameId      string
+	Disabled    bool
+	Servers     int
+	Excluded    int
+	LastSuccess time.Time
+	// Failing is true if the last query of the master server failed
+	Failing bool
+}
+
+// Health is a snapshot of the state of the bot
+type Health struct {
+	Uptime         time.Duration
+	LastRefresh    time.Time
+	Goroutines     int
+	Tasks          int
+	CacheSize      int
+	MastersFailing int
+	Games          []GameHealth
+
+	GatewayConnected bool
+	LastHeartbeatAck time.Time
+}
+
+// recordMasterResult records the outcome of querying the master server of the given game
+func (srv *Server) recordMasterResult(gameId string, err error) {
+	srv.gameServersWriteMutex.Lock()
+	defer srv.gameServersWriteMutex.Unlock()
+
+	status := srv.masterStatus[gameId]
+	status.lastError = err
+	if err == nil {
+		status.lastSuccess = time.Now()
+	}
+	srv.masterStatus[gameId] = status
+}
+
+// gatewayState returns when the gateway last acknowledged a heartbeat, and whether it is connected
+func (srv *Server) gatewayState() (lastAck time.Time, connected bool) {
+	if srv.Session == nil {
+		return time.Time{}, false
+	}
+
+	lastAck = srv.Session.Gateway().EchoBeat()
+	return lastAck, !lastAck.IsZero() && time.Since(lastAck) < gatewayTimeout
+}
+
+// Health returns a snapshot of the state of the bot
+func (srv *Server) Health() Health {
+	masters := srv.Masters()
+	lastAck, connected := srv.gatewayState()
+
+	srv.gameServersWriteMutex.Lock()
+	defer srv.gameServersWriteMutex.Unlock()
+
+	h := Health{
+		Uptime:           time.Since(srv.startTime),
+		LastRefresh:      srv.lastRefresh,
+		Goroutines:       runtime.NumGoroutine(),
+		GatewayConnected: connected,
+		LastHeartbeatAck: lastAck,
+	}
+	for _, n := range srv.tasks.InFlight() {
+		h.Tasks += n
+	}
+
+	for _, m := range masters {
+		status := srv.masterStatus[m.GameId]
+		g := GameHealth{
+			GameId:      m.GameId,
+			Disabled:    m.Disabled,
+			Servers:     len(srv.GameServers[m.GameId]),
+			LastSuccess: status.lastSuccess,
+			Failing:     !m.Disabled && status.lastError != nil,
+		}
+		for _, n := range srv.excluded[m.GameId] {
+			g.Excluded += n
+		}
+		if g.Failing {
+			h.MastersFailing++
+		}
+		h.CacheSize += g.Servers
+		h.Games = append(h.Games, g)
+	}
+
+	return h
+}
+
+// Live reports whether the bot is working, which it isn't if the gateway has silently dropped.
+// The gateway gets some time to connect after startup.
+func (h Health) Live() bool {
+	return h.GatewayConnected || (h.LastHeartbeatAck.IsZero() && h.Uptime < gatewayTimeout)
+}
+
+// Ready reports whether the bot can answer commands, that is the gateway is connected and every
+// enabled master server has been queried successfully
+func (h Health) Ready() bool {
+	if !h.GatewayConnected {
+		return false
+	}
+	for _, g := range h.Games {
+		if !g.Disabled && g.LastSuccess.IsZero() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/trondhumbor/pigeon/internal/filter"
+	"github.com/trondhumbor/pigeon/internal/sorting"
+)
+
+type masterHealthView struct {
+	GameId                  string   `json:"gameId"`
+	Disabled                bool     `json:"disabled"`
+	Failing                 bool     `json:"failing"`
+	Servers                 int      `json:"servers"`
+	SecondsSinceLastSuccess *float64 `json:"secondsSinceLastSuccess"`
+}
+
+type healthView struct {
+	Status                   string             `json:"status"`
+	UptimeSeconds            float64            `json:"uptimeSeconds"`
+	GatewayConnected         bool               `json:"gatewayConnected"`
+	SecondsSinceHeartbeatAck *float64           `json:"secondsSinceHeartbeatAck"`
+	CacheSize                int                `json:"cacheSize"`
+	MastersFailing           int                `json:"mastersFailing"`
+	Masters                  []masterHealthView `json:"masters"`
+}
+
+// secondsSince returns the seconds passed since t, or nil if t is unset
+func secondsSince(t time.Time) *float64 {
+	if t.IsZero() {
+		return nil
+	}
+	s := time.Since(t).Seconds()
+	return &s
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write http response", "err", err)
+	}
+}
+
+// writeHealth responds with the health of the bot, with status 503 if ok is false
+func writeHealth(w http.ResponseWriter, h Health, ok bool) {
+	view := healthView{
+		Status:                   "ok",
+		UptimeSeconds:            h.Uptime.Seconds(),
+		GatewayConnected:         h.GatewayConnected,
+		SecondsSinceHeartbeatAck: secondsSince(h.LastHeartbeatAck),
+		CacheSize:                h.CacheSize,
+		MastersFailing:           h.MastersFailing,
+		Masters:                  []masterHealthView{},
+	}
+	for _, g := range h.Games {
+		view.Masters = append(view.Masters, masterHealthView{
+			GameId:                  g.GameId,
+			Disabled:                g.Disabled,
+			Failing:                 g.Failing,
+			Servers:                 g.Servers,
+			SecondsSinceLastSuccess: secondsSince(g.LastSuccess),
+		})
+	}
+
+	status := http.StatusOK
+	if !ok {
+		view.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, view)
+}
+
+func (srv *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	h := srv.Health()
+	writeHealth(w, h, h.Live())
+}
+
+func (srv *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	h := srv.Health()
+	writeHealth(w, h, h.Ready())
+}
+
+// handleServers lists the cached servers, optionally of a single game, matching a filter expression
+// and in a given sort order, e.g. /servers?game=q3&filter=players>=4&sort=ping
+func (srv *Server) handleServers(w http.ResponseWriter, r *http.Request) {
+	var servers []GameServer
+	if game := r.URL.Query().Get("game"); game != "" {
+		var present bool
+		servers, present = srv.Servers(game)
+		if !present {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "couldn't find specified game in cache"})
+			return
+		}
+	} else {
+		servers = srv.AllServers()
+	}
+
+	mapnames, gametypes := srv.Aliases()
+	f, err := filter.Parse(r.URL.Query().Get("filter"), mapnames, gametypes)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid filter: " + err.Error()})
+		return
+	}
+	servers = f.Apply(servers)
+
+	order := r.URL.Query().Get("sort")
+	if order == "" {
+		order = sorting.Default
+	}
+	sorting.Sort(servers, order)
+
+	if servers == nil {
+		servers = []GameServer{}
+	}
+	writeJSON(w, http.StatusOK, servers)
+}
+
+// ListenHTTP serves the health endpoints and server API on the configured address until the context ends
+func (srv *Server) ListenHTTP(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", srv.handleHealthz)
+	mux.HandleFunc("/readyz", srv.handleReadyz)
+	mux.HandleFunc("/servers", srv.handleServers)
+
+	httpServer := &http.Server{Addr: srv.HTTPAddr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("listening for http requests", "addr", srv.HTTPAddr)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
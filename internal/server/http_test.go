@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestHandleServers(t *testing.T) {
+	srv := &Server{GameServers: map[string][]GameServer{
+		"q3": {
+			{"ip": "1.2.3.4:27960", "hostname": "Busy", "mapname": "q3dm17", "clients": "8", "sv_maxclients": "16"},
+			{"ip": "1.2.3.5:27960", "hostname": "Quiet", "mapname": "q3dm6", "clients": "2", "sv_maxclients": "16"},
+			{"ip": "1.2.3.6:27960", "hostname": "Empty", "mapname": "q3dm17", "clients": "0", "sv_maxclients": "16"},
+		},
+		"css": {
+			{"ip": "5.6.7.8:27015", "hostname": "Dust", "mapname": "de_dust2", "clients": "20", "sv_maxclients": "32"},
+		},
+		"empty": {},
+	}}
+
+	tests := []struct {
+		name   string
+		query  url.Values
+		status int
+		want   []string
+	}{
+		{"every game", nil, http.StatusOK, []string{"Dust", "Busy", "Quiet", "Empty"}},
+		{"one game", url.Values{"game": {"q3"}}, http.StatusOK, []string{"Busy", "Quiet", "Empty"}},
+		{"filter", url.Values{"game": {"q3"}, "filter": {"map:q3dm17"}}, http.StatusOK, []string{"Busy", "Empty"}},
+		{"sort", url.Values{"game": {"q3"}, "sort": {"hostname"}}, http.StatusOK, []string{"Busy", "Empty", "Quiet"}},
+		{"no matches", url.Values{"filter": {"players>100"}}, http.StatusOK, []string{}},
+		{"game without servers", url.Values{"game": {"empty"}}, http.StatusOK, []string{}},
+		{"unknown game", url.Values{"game": {"q2"}}, http.StatusNotFound, nil},
+		{"invalid filter", url.Values{"filter": {"players>=many"}}, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		srv.handleServers(w, httptest.NewRequest(http.MethodGet, "/servers?"+tt.query.Encode(), nil))
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+			continue
+		}
+		if tt.want == nil {
+			continue
+		}
+
+		var servers []GameServer
+		if err := json.Unmarshal(w.Body.Bytes(), &servers); err != nil {
+			t.Errorf("%s: response %q isn't a list of servers: %v", tt.name, w.Body, err)
+			continue
+		}
+		hostnames := []string{}
+		for _, s := range servers {
+			hostnames = append(hostnames, s["hostname"])
+		}
+		if !reflect.DeepEqual(hostnames, tt.want) {
+			t.Errorf("%s: servers = %v, want %v", tt.name, hostnames, tt.want)
+		}
+		if servers == nil {
+			t.Errorf("%s: response = %q, want an empty list rather than null", tt.name, w.Body)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultLANPort is the port Quake 3 servers listen on unless told otherwise
+	defaultLANPort = 27960
+	// defaultLANWait is how long replies to a broadcast are collected for by default
+	defaultLANWait = 2 * time.Second
+)
+
+// LANDiscovery finds servers on local networks by broadcasting getinfo to them, for events
+// where no master server is reachable
+type LANDiscovery struct {
+	// Networks are the IPv4 subnets to broadcast to, e.g. "192.168.1.0/24", or broadcast
+	// addresses such as "255.255.255.255"
+	Networks []string `json:"networks"`
+	// Ports are the ports servers may listen on, 27960 if empty
+	Ports []int `json:"ports,omitempty"`
+	// Wait is how long to collect replies for, 0 uses the default of 2 seconds
+	Wait Duration `json:"wait,omitempty"`
+}
+
+func (d LANDiscovery) wait() time.Duration {
+	if d.Wait.Duration <= 0 {
+		return defaultLANWait
+	}
+	return d.Wait.Duration
+}
+
+// broadcastAddresses returns every broadcast address and port combination to send getinfo to
+func (d LANDiscovery) broadcastAddresses() ([]string, error) {
+	ports := d.Ports
+	if len(ports) == 0 {
+		ports = []int{defaultLANPort}
+	}
+
+	var addresses []string
+	for _, network := range d.Networks {
+		ip, err := broadcastIP(network)
+		if err != nil {
+			return nil, err
+		}
+		for _, port := range ports {
+			addresses = append(addresses, net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+		}
+	}
+	return addresses, nil
+}
+
+// broadcastIP returns the broadcast address of an IPv4 subnet, or the address itself if it isn't a subnet
+func broadcastIP(network string) (net.IP, error) {
+	if ip := net.ParseIP(network); ip != nil && ip.To4() != nil {
+		return ip.To4(), nil
+	}
+
+	_, subnet, err := net.ParseCIDR(network)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lan network %q, expected an IPv4 subnet or address", network)
+	}
+	ip := subnet.IP.To4()
+	if ip == nil || len(subnet.Mask) != net.IPv4len {
+		return nil, fmt.Errorf("invalid lan network %q, broadcasts are IPv4 only", network)
+	}
+
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range ip {
+		broadcast[i] = ip[i] | ^subnet.Mask[i]
+	}
+	return broadcast, nil
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBroadcastIP(t *testing.T) {
+	tests := []struct {
+		network string
+		want    string
+		err     bool
+	}{
+		{"192.168.1.0/24", "192.168.1.255", false},
+		{"192.168.1.77/24", "192.168.1.255", false},
+		{"10.0.0.0/8", "10.255.255.255", false},
+		{"172.16.0.0/20", "172.16.15.255", false},
+		{"192.168.1.10/32", "192.168.1.10", false},
+		{"255.255.255.255", "255.255.255.255", false},
+		{"192.168.1.10", "192.168.1.10", false},
+		{"fd00::/64", "", true},
+		{"fd00::1", "", true},
+		{"::ffff:192.168.1.0/120", "", true},
+		{"lan", "", true},
+	}
+
+	for _, tt := range tests {
+		ip, err := broadcastIP(tt.network)
+		if (err != nil) != tt.err {
+			t.Errorf("broadcastIP(%q) error = %v, want error %v", tt.network, err, tt.err)
+			continue
+		}
+		if err == nil && ip.String() != tt.want {
+			t.Errorf("broadcastIP(%q) = %s, want %s", tt.network, ip, tt.want)
+		}
+	}
+}
+
+func TestBroadcastAddresses(t *testing.T) {
+	d := LANDiscovery{Networks: []string{"192.168.1.0/24", "10.0.0.255"}}
+	got, err := d.broadcastAddresses()
+	if err != nil {
+		t.Fatalf("broadcastAddresses() returned error: %v", err)
+	}
+	if want := []string{"192.168.1.255:27960", "10.0.0.255:27960"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("broadcastAddresses() = %v, want %v", got, want)
+	}
+
+	d.Ports = []int{27960, 27961}
+	got, _ = d.broadcastAddresses()
+	want := []string{"192.168.1.255:27960", "192.168.1.255:27961", "10.0.0.255:27960", "10.0.0.255:27961"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("broadcastAddresses() with two ports = %v, want %v", got, want)
+	}
+}
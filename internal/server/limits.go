@@ -0,0 +1,104 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/trondhumbor/pigeon/internal/query"
+)
+
+// The reasons a server can be excluded from the cache for
+const (
+	ReasonMalformedCounts  = "malformed player counts"
+	ReasonNegativeCounts   = "negative player counts"
+	ReasonAboveLimit       = "more players than the game allows"
+	ReasonBotsAboveClients = "more bots than clients"
+	ReasonClientsAboveMax  = "more clients than slots"
+)
+
+// DefaultQ3MaxClients is the client cap of q3 masters which don't configure one, as the bot
+// always hid q3 servers reporting more than 18 clients, bots or slots
+const DefaultQ3MaxClients = 18
+
+// Limits are the sanity bounds a server of a game must be within to be listed
+type Limits struct {
+	// MaxClients is the largest number of clients, bots or slots a server can have. 0 means the
+	// default of the protocol, DefaultQ3MaxClients for q3 and no limit otherwise, and a negative
+	// value means no limit.
+	MaxClients int `json:"maxClients,omitempty"`
+	// AllowBotsAboveClients allows for games which don't count bots as clients
+	AllowBotsAboveClients bool `json:"allowBotsAboveClients,omitempty"`
+	// AllowClientsAboveMax allows for games where spectators or reserved slots aren't part of sv_maxclients
+	AllowClientsAboveMax bool `json:"allowClientsAboveMax,omitempty"`
+}
+
+// EffectiveLimits returns the sanity limits of the master server, with the protocol default filled in
+func (m MasterServer) EffectiveLimits() Limits {
+	l := m.Limits
+	if l.MaxClients == 0 && (m.Protocol == "" || m.Protocol == query.DefaultDriver) {
+		l.MaxClients = DefaultQ3MaxClients
+	}
+	return l
+}
+
+// Check returns the reason the server is outside the limits, or an empty string if it is within them
+func (l Limits) Check(info GameServer) string {
+	c, cerr := strconv.Atoi(info["clients"])
+	m, merr := strconv.Atoi(info["sv_maxclients"])
+	if cerr != nil || merr != nil {
+		return ReasonMalformedCounts
+	}
+
+	// not every game reports bots, so a missing value means there are none
+	b := 0
+	if val, present := info["bots"]; present {
+		var berr error
+		b, berr = strconv.Atoi(val)
+		if berr != nil {
+			return ReasonMalformedCounts
+		}
+	}
+
+	if c < 0 || b < 0 || m < 0 {
+		return ReasonNegativeCounts
+	}
+
+	if l.MaxClients > 0 && (c > l.MaxClients || b > l.MaxClients || m > l.MaxClients) {
+		return ReasonAboveLimit
+	}
+
+	if !l.AllowBotsAboveClients && b > c {
+		return ReasonBotsAboveClients
+	}
+
+	if !l.AllowClientsAboveMax && c > m {
+		return ReasonClientsAboveMax
+	}
+
+	return ""
+}
+
+// Excluded returns how many servers of the given game were excluded from the cache, by reason
+func (srv *Server) Excluded(gameId string) map[string]int {
+	srv.gameServersWriteMutex.Lock()
+	defer srv.gameServersWriteMutex.Unlock()
+
+	excluded := make(map[string]int)
+	for reason, n := range srv.excluded[gameId] {
+		excluded[reason] = n
+	}
+	return excluded
+}
+
+// AllExcluded returns how many servers of every game were excluded from the cache, by reason
+func (srv *Server) AllExcluded() map[string]int {
+	srv.gameServersWriteMutex.Lock()
+	defer srv.gameServersWriteMutex.Unlock()
+
+	excluded := make(map[string]int)
+	for _, reasons := range srv.excluded {
+		for reason, n := range reasons {
+			excluded[reason] += n
+		}
+	}
+	return excluded
+}
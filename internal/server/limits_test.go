@@ -0,0 +1,41 @@
+package server
+
+import "testing"
+
+func TestLimitsCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		info   GameServer
+		want   string
+	}{
+		{"within limits", Limits{MaxClients: 18}, GameServer{"clients": "8", "bots": "2", "sv_maxclients": "16"}, ""},
+		{"missing bots", Limits{MaxClients: 18}, GameServer{"clients": "8", "sv_maxclients": "16"}, ""},
+		{"missing clients", Limits{}, GameServer{"bots": "2", "sv_maxclients": "16"}, ReasonMalformedCounts},
+		{"missing slots", Limits{}, GameServer{"clients": "8"}, ReasonMalformedCounts},
+		{"malformed bots", Limits{}, GameServer{"clients": "8", "bots": "two", "sv_maxclients": "16"}, ReasonMalformedCounts},
+		{"negative clients", Limits{}, GameServer{"clients": "-1", "sv_maxclients": "16"}, ReasonNegativeCounts},
+		{"negative bots", Limits{}, GameServer{"clients": "8", "bots": "-2", "sv_maxclients": "16"}, ReasonNegativeCounts},
+		{"negative slots", Limits{}, GameServer{"clients": "0", "sv_maxclients": "-16"}, ReasonNegativeCounts},
+		{"at the limit", Limits{MaxClients: 18}, GameServer{"clients": "18", "bots": "18", "sv_maxclients": "18"}, ""},
+		{"clients above the limit", Limits{MaxClients: 18}, GameServer{"clients": "19", "sv_maxclients": "32"}, ReasonAboveLimit},
+		{"slots above the limit", Limits{MaxClients: 18}, GameServer{"clients": "4", "sv_maxclients": "64"}, ReasonAboveLimit},
+		{"no limit", Limits{MaxClients: -1}, GameServer{"clients": "200", "sv_maxclients": "256"}, ""},
+		{"bots above clients", Limits{}, GameServer{"clients": "2", "bots": "4", "sv_maxclients": "16"}, ReasonBotsAboveClients},
+		{
+			"bots above clients allowed", Limits{AllowBotsAboveClients: true},
+			GameServer{"clients": "2", "bots": "4", "sv_maxclients": "16"}, "",
+		},
+		{"clients above slots", Limits{}, GameServer{"clients": "18", "sv_maxclients": "16"}, ReasonClientsAboveMax},
+		{
+			"clients above slots allowed", Limits{AllowClientsAboveMax: true},
+			GameServer{"clients": "18", "sv_maxclients": "16"}, "",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.limits.Check(tt.info); got != tt.want {
+			t.Errorf("%s: Check() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+)
+
+// MemberPermissions calculates the permissions the member has in the given channel
+func (srv *Server) MemberPermissions(channelID discord.ChannelID, member *discord.Member) (discord.Permissions, error) {
+	guild, err := srv.Session.Guild(srv.GuildID)
+	if err != nil {
+		return 0, fmt.Errorf("fetching guild: %v", err)
+	}
+
+	channel, err := srv.Session.Channel(channelID)
+	if err != nil {
+		return 0, fmt.Errorf("fetching channel: %v", err)
+	}
+
+	return discord.CalcOverwrites(*guild, *channel, *member), nil
+}
+
+// hasRole reports whether the member has any of the given roles
+func hasRole(member *discord.Member, roles []discord.RoleID) bool {
+	for _, have := range member.RoleIDs {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the member may use the admin command in the given channel
+func (srv *Server) IsAdmin(channelID discord.ChannelID, member *discord.Member) (bool, error) {
+	if member == nil {
+		return false, nil
+	}
+
+	srv.configMutex.RLock()
+	adminRoles := srv.AdminRoles
+	srv.configMutex.RUnlock()
+
+	if hasRole(member, adminRoles) {
+		return true, nil
+	}
+
+	perms, err := srv.MemberPermissions(channelID, member)
+	if err != nil {
+		return false, err
+	}
+
+	return perms.Has(discord.PermissionAdministrator) || perms.Has(discord.PermissionManageGuild), nil
+}
+
+// CommandPermissions restricts who may use a command and where
+type CommandPermissions struct {
+	// AllowedRoles may use the command, everyone may use it if it is empty
+	AllowedRoles []discord.RoleID `json:"allowedRoles,omitempty"`
+	// AllowedChannels are where the command may be used, it may be used anywhere if it is empty
+	AllowedChannels []discord.ChannelID `json:"allowedChannels,omitempty"`
+	// DefaultMemberPermissions is registered with the command, so discord hides it from members
+	// lacking any of the permissions. It is also checked when the command is used. 0 means unset.
+	DefaultMemberPermissions discord.Permissions `json:"defaultMemberPermissions,string,omitempty"`
+}
+
+// commandPermissions returns the configured permissions of the command with the given name
+func (srv *Server) commandPermissions(name string) CommandPermissions {
+	srv.configMutex.RLock()
+	defer srv.configMutex.RUnlock()
+	return srv.Permissions[name]
+}
+
+// checkPermissions returns why the sender of the interaction may not use the command with the
+// given name, or an empty string if they may
+func (srv *Server) checkPermissions(event *gateway.InteractionCreateEvent, name string) (string, error) {
+	perms := srv.commandPermissions(name)
+
+	if len(perms.AllowedChannels) > 0 {
+		allowed := false
+		for _, id := range perms.AllowedChannels {
+			if id == event.ChannelID {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return "this command can't be used in this channel.", nil
+		}
+	}
+
+	if len(perms.AllowedRoles) == 0 && perms.DefaultMemberPermissions == 0 {
+		return "", nil
+	}
+
+	// roles and permissions only exist within a guild
+	if event.Member == nil {
+		return "this command can only be used in the server.", nil
+	}
+
+	if len(perms.AllowedRoles) > 0 && !hasRole(event.Member, perms.AllowedRoles) {
+		return "you don't have a role allowed to use this command.", nil
+	}
+
+	if perms.DefaultMemberPermissions != 0 {
+		have, err := srv.MemberPermissions(event.ChannelID, event.Member)
+		if err != nil {
+			return "", err
+		}
+		if have&perms.DefaultMemberPermissions != perms.DefaultMemberPermissions {
+			return "you don't have the permissions required to use this command.", nil
+		}
+	}
+
+	return "", nil
+}
+
+// enforcePermissions checks whether the sender of the interaction may use the command with the
+// given name, and tells them why if they may not. It returns whether handling should continue.
+func (srv *Server) enforcePermissions(event *gateway.InteractionCreateEvent, name string) bool {
+	reason, err := srv.checkPermissions(event, name)
+	if err != nil {
+		interactionLogger(event, name).Error("error occurred checking permissions", "err", err)
+		reason = "couldn't check your permissions, please try again later."
+	}
+
+	if reason == "" {
+		return true
+	}
+
+	srv.respondEphemeral(event, reason)
+	return false
+}
+
+// respondEphemeral responds to the interaction with a message only the sender can see
+func (srv *Server) respondEphemeral(event *gateway.InteractionCreateEvent, content string) {
+	interactionResp := api.InteractionResponse{
+		Type: api.MessageInteractionWithSource,
+		Data: &api.InteractionResponseData{
+			Content: option.NewNullableString(content),
+			Flags:   api.EphemeralResponse,
+		},
+	}
+	if err := srv.Session.RespondInteraction(event.ID, event.Token, interactionResp); err != nil {
+		slog.Error("failed to send interaction callback", "guild", event.GuildID, "user", event.SenderID(), "err", err)
+	}
+}
+
+// commandData is the data of a command as registered with discord, including its default member
+// permissions which the CreateCommandData of our discord library lacks
+type commandData struct {
+	api.CreateCommandData
+	DefaultMemberPermissions discord.Permissions
+}
+
+// MarshalJSON adds default_member_permissions to the marshalled CreateCommandData
+func (c commandData) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(c.CreateCommandData)
+	if err != nil || c.DefaultMemberPermissions == 0 {
+		return b, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	perms, err := json.Marshal(strconv.FormatUint(uint64(c.DefaultMemberPermissions), 10))
+	if err != nil {
+		return nil, err
+	}
+	fields["default_member_permissions"] = perms
+
+	return json.Marshal(fields)
+}
+
+// overwriteGuildCommands registers the commands in the guild, replacing all existing ones
+func (srv *Server) overwriteGuildCommands(cmds []commandData) error {
+	return srv.Session.RequestJSON(
+		nil, "PUT",
+		api.EndpointApplications+srv.AppID.String()+"/guilds/"+srv.GuildID.String()+"/commands",
+		httputil.WithJSONBody(cmds))
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/trondhumbor/pigeon/internal/query"
+)
+
+// Driver returns the query driver of the master server's protocol
+func (m MasterServer) Driver() (query.Driver, error) {
+	if m.Protocol == "" {
+		return query.Lookup(query.DefaultDriver)
+	}
+	return query.Lookup(m.Protocol)
+}
+
+// Validate returns why the master server can't be queried, such as an unknown protocol, or
+// endpoints the protocol can't list servers from
+func (m MasterServer) Validate() error {
+	driver, err := m.Driver()
+	if err != nil {
+		return err
+	}
+	if len(m.AllEndpoints()) > 0 {
+		return query.CheckList(driver, m.ListOptions())
+	}
+	return nil
+}
+
+// ListOptions returns what the master server is asked to list servers for
+func (m MasterServer) ListOptions() query.ListOptions {
+	return query.ListOptions{GameId: m.GameId, Version: m.Version, IPv6: m.IPv6, Region: m.Region, Filter: m.Filter}
+}
+
+// UnmarshalJSON reads a master server, where the protocol is either the name of a driver, or
+// the protocol version of the default driver as in older configs
+func (m *MasterServer) UnmarshalJSON(b []byte) error {
+	type plain MasterServer
+	var raw struct {
+		plain
+		Protocol json.RawMessage `json:"protocol"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*m = MasterServer(raw.plain)
+
+	if len(raw.Protocol) == 0 || string(raw.Protocol) == "null" {
+		m.Protocol = query.DefaultDriver
+		return nil
+	}
+
+	var version int
+	if err := json.Unmarshal(raw.Protocol, &version); err == nil {
+		m.Protocol = query.DefaultDriver
+		if m.Version == 0 {
+			m.Version = version
+		}
+		return nil
+	}
+
+	if err := json.Unmarshal(raw.Protocol, &m.Protocol); err != nil {
+		return fmt.Errorf("protocol of %q is neither a driver name nor a version: %s", m.GameId, raw.Protocol)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMasterServerUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		protocol string
+		version  int
+		err      bool
+	}{
+		{"legacy version", `{"gameId": "q3", "protocol": 68}`, "q3", 68, false},
+		{"legacy version with version", `{"gameId": "q3", "protocol": 68, "version": 71}`, "q3", 71, false},
+		{"driver name", `{"gameId": "css", "protocol": "source"}`, "source", 0, false},
+		{"driver name with version", `{"gameId": "q3", "protocol": "q3", "version": 68}`, "q3", 68, false},
+		{"null", `{"gameId": "q3", "protocol": null}`, "q3", 0, false},
+		{"missing", `{"gameId": "q3"}`, "q3", 0, false},
+		{"boolean", `{"gameId": "q3", "protocol": true}`, "", 0, true},
+		{"object", `{"gameId": "q3", "protocol": {"name": "q3"}}`, "", 0, true},
+		{"fractional version", `{"gameId": "q3", "protocol": 68.5}`, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		var m MasterServer
+		err := json.Unmarshal([]byte(tt.in), &m)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: UnmarshalJSON() error = %v, want error %v", tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if m.Protocol != tt.protocol || m.Version != tt.version {
+			t.Errorf("%s: UnmarshalJSON() = protocol %q version %d, want %q and %d",
+				tt.name, m.Protocol, m.Version, tt.protocol, tt.version)
+		}
+		if m.GameId == "" {
+			t.Errorf("%s: UnmarshalJSON() lost the other fields: %+v", tt.name, m)
+		}
+	}
+}
+
+func TestMasterServerValidate(t *testing.T) {
+	var m MasterServer
+	if err := json.Unmarshal([]byte(`{"gameId": "q3", "protocol": "q2"}`), &m); err != nil {
+		t.Fatalf("UnmarshalJSON() returned error: %v", err)
+	}
+	if err := m.Validate(); err == nil {
+		t.Errorf("Validate() of an unknown driver name returned no error")
+	}
+}
+
+func TestEffectiveLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		master MasterServer
+		want   int
+	}{
+		{"q3 default", MasterServer{Protocol: "q3"}, 18},
+		{"protocol unset", MasterServer{}, 18},
+		{"q3 configured", MasterServer{Protocol: "q3", Limits: Limits{MaxClients: 64}}, 64},
+		{"q3 unlimited", MasterServer{Protocol: "q3", Limits: Limits{MaxClients: -1}}, -1},
+		{"other protocol", MasterServer{Protocol: "source"}, 0},
+		{"other protocol configured", MasterServer{Protocol: "gamespy3", Limits: Limits{MaxClients: 32}}, 32},
+	}
+
+	for _, tt := range tests {
+		if got := tt.master.EffectiveLimits().MaxClients; got != tt.want {
+			t.Errorf("%s: EffectiveLimits().MaxClients = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"strconv"
+	"time"
+)
+
+// The keys the bot adds to the info of a cached server
+const (
+	// KeyLastSeen is when the server last responded, in unix seconds
+	KeyLastSeen = "lastseen"
+	// KeyMissed is how many refreshes in a row the server hasn't responded in. It is only
+	// present on servers kept from an earlier refresh.
+	KeyMissed = "missed"
+)
+
+const (
+	defaultRetries     = 1
+	defaultRetryDelay  = 5 * time.Second
+	defaultMaxFailures = 3
+)
+
+// Retention decides how servers which stop responding are retried and kept in the cache
+type Retention struct {
+	// Retries is how many more times a server which didn't respond is queried within a refresh.
+	// 0 uses the default of 1, a negative value disables retries.
+	Retries int `json:"retries,omitempty"`
+	// RetryDelay is how long to wait before retrying, 0 uses the default of 5 seconds
+	RetryDelay Duration `json:"retryDelay,omitempty"`
+	// MaxFailures is how many refreshes in a row a server may not respond in before it is dropped
+	// from the cache. 0 uses the default of 3, a negative value drops it at once.
+	MaxFailures int `json:"maxFailures,omitempty"`
+}
+
+func (r Retention) retries() int {
+	if r.Retries == 0 {
+		return defaultRetries
+	}
+	if r.Retries < 0 {
+		return 0
+	}
+	return r.Retries
+}
+
+func (r Retention) retryDelay() time.Duration {
+	if r.RetryDelay.Duration <= 0 {
+		return defaultRetryDelay
+	}
+	return r.RetryDelay.Duration
+}
+
+func (r Retention) maxFailures() int {
+	if r.MaxFailures == 0 {
+		return defaultMaxFailures
+	}
+	if r.MaxFailures < 0 {
+		return 1
+	}
+	return r.MaxFailures
+}
+
+// retain returns a copy of the cached info of a server which didn't respond, with its missed
+// refreshes counted up, or false if it has missed too many and should be dropped
+func (r Retention) retain(previous GameServer) (GameServer, bool) {
+	missed, _ := strconv.Atoi(previous[KeyMissed])
+	missed++
+	if missed >= r.maxFailures() {
+		return nil, false
+	}
+
+	info := make(GameServer, len(previous)+1)
+	for k, v := range previous {
+		info[k] = v
+	}
+	info[KeyMissed] = strconv.Itoa(missed)
+	return info, true
+}
+
+// LastSeen returns when the server last responded, if known
+func LastSeen(info GameServer) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(info[KeyLastSeen], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// IsStale reports whether the server didn't respond in the last refresh, and is listed with
+// the info it had when it was last seen
+func IsStale(info GameServer) bool {
+	_, present := info[KeyMissed]
+	return present
+}
@@ -0,0 +1,44 @@
+package server
+
+import "testing"
+
+func TestRetentionRetain(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxFailures int
+		missed      string
+		want        string
+	}{
+		{"default first miss", 0, "", "1"},
+		{"default second miss", 0, "1", "2"},
+		{"default third miss", 0, "2", ""},
+		{"negative", -1, "", ""},
+		{"one", 1, "", ""},
+		{"two first miss", 2, "", "1"},
+		{"two second miss", 2, "1", ""},
+		{"above the maximum", 2, "5", ""},
+		{"malformed count", 2, "many", "1"},
+	}
+
+	for _, tt := range tests {
+		previous := GameServer{"ip": "1.2.3.4:27960", "hostname": "Test server"}
+		if tt.missed != "" {
+			previous[KeyMissed] = tt.missed
+		}
+
+		info, ok := Retention{MaxFailures: tt.maxFailures}.retain(previous)
+		if ok != (tt.want != "") {
+			t.Errorf("%s: retain() kept = %v, want %v", tt.name, ok, tt.want != "")
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if info[KeyMissed] != tt.want || info["hostname"] != "Test server" || !IsStale(info) {
+			t.Errorf("%s: retain() = %v, want the previous info with %s missed", tt.name, info, tt.want)
+		}
+		if previous[KeyMissed] != tt.missed {
+			t.Errorf("%s: retain() changed the previous info to %v", tt.name, previous)
+		}
+	}
+}
@@ -1,17 +1,23 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/diamondburned/arikawa/v3/api"
 	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/diamondburned/arikawa/v3/gateway"
 	"github.com/diamondburned/arikawa/v3/session"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
 	"github.com/trondhumbor/pigeon/internal/command"
+	"github.com/trondhumbor/pigeon/internal/logging"
+	"github.com/trondhumbor/pigeon/internal/pagination"
+	"github.com/trondhumbor/pigeon/internal/supervisor"
 )
 
 // CreateCommand is a function that returns a list of SlashCommands
@@ -19,9 +25,35 @@ type CreateCommand func(*Server) (command.SlashCommand, error)
 type GameServer = map[string]string
 
 type MasterServer struct {
-	GameId   string `json:"gameId"`
-	Protocol int    `json:"protocol"`
+	GameId string `json:"gameId"`
+	// Protocol names the query driver, see query.Drivers. Older configs have the protocol
+	// version of the q3 driver here instead, which is still accepted.
+	Protocol string `json:"protocol"`
+	// Version is the protocol version of the game, for the protocols which have one
+	Version  int    `json:"version,omitempty"`
 	Endpoint string `json:"endpoint"`
+	// Endpoints are further masters listing the same game. They are all queried, and their
+	// results merged, so the game stays listed while some of them are down.
+	Endpoints []string `json:"endpoints,omitempty"`
+	Disabled  bool     `json:"disabled,omitempty"`
+	// IPv6 asks the masters for IPv6 servers too, with getserversExt for the q3 driver
+	IPv6 bool `json:"ipv6,omitempty"`
+	// Region and Filter narrow down the servers the masters list, for the source driver e.g.
+	// "europe" and "\\appid\\240\\dedicated\\1". They are passed on to the driver as is.
+	Region string `json:"region,omitempty"`
+	Filter string `json:"filter,omitempty"`
+
+	// Servers are queried in addition to the ones the masters list, for servers which never
+	// register with a master. A game may have only these, and no endpoints.
+	Servers []string `json:"servers,omitempty"`
+	// ServerListURL is fetched on every refresh for a JSON list of further server addresses
+	ServerListURL string `json:"serverListURL,omitempty"`
+	// LAN discovers servers by broadcasting to local networks on every refresh
+	LAN *LANDiscovery `json:"lan,omitempty"`
+
+	Limits    Limits    `json:"limits"`
+	Detection Detection `json:"detection"`
+	Retention Retention `json:"retention"`
 }
 
 // Server is the config and main server
@@ -34,49 +66,123 @@ type Server struct {
 	Mapnames  map[string]string `json:"mapNames,omitempty"`
 	Gametypes map[string]string `json:"gameTypes,omitempty"`
 
+	// Blocklist holds servers which are never listed, unless they are also in the Allowlist.
+	// Allowlisted servers are exempt from the fake server detection.
+	Blocklist AddressList `json:"blocklist,omitempty"`
+	Allowlist AddressList `json:"allowlist,omitempty"`
+
+	// AdminRoles may use the admin command, in addition to members with the Administrator or
+	// Manage Server permission
+	AdminRoles []discord.RoleID `json:"adminRoles,omitempty"`
+
+	// Permissions restricts the use of the commands with the given names
+	Permissions map[string]CommandPermissions `json:"permissions,omitempty"`
+
+	// Cooldowns limits how often the commands with the given names can be used
+	Cooldowns map[string]Cooldown `json:"cooldowns,omitempty"`
+
+	// AdminLogChannel receives the full details of errors occurring while handling commands
+	AdminLogChannel discord.ChannelID `json:"adminLogChannel,omitempty"`
+
+	// StatePath is where runtime data, such as the history used to detect fake servers, is kept
+	// across restarts
+	StatePath string `json:"statePath,omitempty"`
+
+	// HTTPAddr is the address to serve the health endpoints and server API on, e.g. ":8080".
+	// They are disabled if it is empty.
+	HTTPAddr string `json:"httpAddr,omitempty"`
+
+	// Log configures the logs, command line flags take precedence over it
+	Log logging.Config `json:"log"`
+
+	configPath  string
+	configMutex sync.RWMutex
+	startTime   time.Time
+
+	// ctx ends when the server shuts down, cancelling the queries in flight
+	ctx context.Context
+
 	commands map[string]command.SlashCommand
 
-	Session               *session.Session
-	LastMessages          map[discord.ChannelID]*gateway.MessageCreateEvent
+	Session               *session.Session                                  `json:"-"`
+	LastMessages          map[discord.ChannelID]*gateway.MessageCreateEvent `json:"-"`
 	lastMessageWriteMutex sync.Mutex
 
-	GameServers           map[string][]GameServer
+	GameServers           map[string][]GameServer `json:"-"`
+	lastRefresh           time.Time
+	masterStatus          map[string]masterStatus
+	excluded              map[string]map[string]int
 	gameServersWriteMutex sync.Mutex
+
+	countHistory      map[string]countRecord
+	countHistoryMutex sync.Mutex
+
+	cooldowns     map[string]time.Time
+	cooldownMutex sync.Mutex
+
+	Pages *pagination.Store `json:"-"`
+
+	tasks      *supervisor.Supervisor
+	querySlots chan struct{}
 }
 
 // New creates a new server instance with initialized variables
-func New(configpath string) (srv Server, err error) {
-	srv = Server{
+func New(configpath string) (srv *Server, err error) {
+	srv = &Server{
 		LastMessages: make(map[discord.ChannelID]*gateway.MessageCreateEvent),
 		GameServers:  make(map[string][]GameServer),
+		excluded:     make(map[string]map[string]int),
+		masterStatus: make(map[string]masterStatus),
+		countHistory: make(map[string]countRecord),
+		cooldowns:    make(map[string]time.Time),
+		Pages:        pagination.New(30 * time.Minute),
+		configPath:   configpath,
+		startTime:    time.Now(),
+		querySlots:   make(chan struct{}, maxConcurrentQueries),
 	}
+	srv.tasks = supervisor.New(srv.reportPanic)
 
-	log.Printf("reading config file from %q", configpath)
+	slog.Info("reading config file", "path", configpath)
 	f, err := ioutil.ReadFile(configpath)
 	if err != nil {
-		log.Printf("failed to read file: %v", err)
+		slog.Error("failed to read file", "path", configpath, "err", err)
 		return
 	}
 
 	err = json.Unmarshal(f, &srv)
 	if err != nil {
-		log.Printf("failed to unmarshall file: %v", err)
+		slog.Error("failed to unmarshall file", "path", configpath, "err", err)
 		return
 	}
 
+	for _, m := range srv.MasterServers {
+		if err = m.Validate(); err != nil {
+			slog.Error("invalid master server", "gameId", m.GameId, "err", err)
+			return
+		}
+	}
+
 	srv.commands = map[string]command.SlashCommand{}
 
+	err = srv.loadState()
+	if err != nil {
+		slog.Error("failed to load state", "err", err)
+		return
+	}
+
 	return
 }
 
-// Initialize the server with the given session
-func (srv *Server) Initialize(s *session.Session, commandCreators []CreateCommand) error {
+// Initialize the server with the given session. The server runs until the context ends,
+// after which Shutdown should be called.
+func (srv *Server) Initialize(ctx context.Context, s *session.Session, commandCreators []CreateCommand) error {
 	srv.Session = s
+	srv.ctx = ctx
 
-	log.Printf("creating/updating %d guild commands...", len(commandCreators))
+	slog.Info("creating/updating guild commands", "guild", srv.GuildID, "count", len(commandCreators))
 
 	cmdMap := make(map[string]command.SlashCommand)
-	cmdList := []api.CreateCommandData{}
+	cmdList := []commandData{}
 
 	for _, createCMD := range commandCreators {
 		cmd, err := createCMD(srv)
@@ -85,20 +191,41 @@ func (srv *Server) Initialize(s *session.Session, commandCreators []CreateComman
 		}
 
 		cmdMap[cmd.CommandData.Name] = cmd
-		cmdList = append(cmdList, cmd.CommandData)
+		cmdList = append(cmdList, commandData{
+			CreateCommandData:        cmd.CommandData,
+			DefaultMemberPermissions: srv.commandPermissions(cmd.CommandData.Name).DefaultMemberPermissions,
+		})
 	}
 
-	_, err := s.BulkOverwriteGuildCommands(srv.AppID, srv.GuildID, cmdList)
+	err := srv.overwriteGuildCommands(cmdList)
 	if err != nil {
 		return fmt.Errorf("bulk overwrite guild commands: %v", err)
 	}
 
-	go srv.PopulateGameServers()
+	srv.PopulateGameServers(ctx)
+
+	if srv.HTTPAddr != "" {
+		srv.tasks.Go("http", func() {
+			if err := srv.ListenHTTP(ctx); err != nil {
+				slog.Error("http server stopped", "addr", srv.HTTPAddr, "err", err)
+			}
+		})
+	}
 
 	srv.commands = cmdMap
 	return nil
 }
 
+// Shutdown waits for the supervised tasks in flight to finish, giving up when the context ends,
+// and then saves the state
+func (srv *Server) Shutdown(ctx context.Context) error {
+	if err := srv.tasks.Wait(ctx); err != nil {
+		slog.Warn("gave up waiting for tasks in flight", "tasks", srv.tasks.InFlight())
+	}
+
+	return srv.saveState()
+}
+
 // MessageCreateHandler handles every incoming normal message
 func (srv *Server) MessageCreateHandler(c *gateway.MessageCreateEvent) {
 	srv.lastMessageWriteMutex.Lock()
@@ -108,12 +235,181 @@ func (srv *Server) MessageCreateHandler(c *gateway.MessageCreateEvent) {
 
 // HandleInteraction is a handler-function handling interaction-events
 func (srv *Server) HandleInteraction(ev *gateway.InteractionCreateEvent) {
-	switch ev.Data.(type) {
+	var name string
+	var handle func()
+
+	switch data := ev.Data.(type) {
 	case *discord.CommandInteraction:
-		data := ev.Data.(*discord.CommandInteraction)
-		srv.handleCommandInteraction(ev, data)
+		name = data.Name
+		handle = func() { srv.handleCommandInteraction(ev, data) }
+	case discord.ComponentInteraction:
+		name, _ = command.ParseCustomID(data.ID())
+		handle = func() { srv.handleComponentInteraction(ev, data) }
+	case *discord.ModalInteraction:
+		name, _ = command.ParseCustomID(data.CustomID)
+		handle = func() { srv.handleModalInteraction(ev, data) }
+	case *discord.AutocompleteInteraction:
+		name = data.Name
+		handle = func() { srv.handleAutocompleteInteraction(ev, data) }
+	default:
 		return
 	}
+
+	if err := srv.tasks.Run("interaction "+name, handle); err != nil {
+		srv.reportError(ev, name, err)
+	}
+}
+
+// handleComponentInteraction routes button and select menu interactions to the command owning the custom ID
+func (srv *Server) handleComponentInteraction(
+	event *gateway.InteractionCreateEvent,
+	data discord.ComponentInteraction,
+) {
+	name, args := command.ParseCustomID(data.ID())
+	cmd, exists := srv.commands[name]
+	if !exists || cmd.HandleComponent == nil {
+		interactionLogger(event, name).Warn("no command handles component", "customId", data.ID())
+		return
+	}
+
+	if !srv.enforcePermissions(event, name) {
+		return
+	}
+
+	resp, err := cmd.HandleComponent(event, data, args)
+	if err != nil {
+		srv.reportError(event, name, err)
+		return
+	}
+
+	if err := srv.Session.RespondInteraction(event.ID, event.Token, *resp); err != nil {
+		interactionLogger(event, name).Error("failed to send interaction callback", "err", err)
+	}
+}
+
+// handleModalInteraction routes submitted modals to the command owning the custom ID
+func (srv *Server) handleModalInteraction(
+	event *gateway.InteractionCreateEvent,
+	data *discord.ModalInteraction,
+) {
+	name, args := command.ParseCustomID(data.CustomID)
+	cmd, exists := srv.commands[name]
+	if !exists || cmd.HandleModal == nil {
+		interactionLogger(event, name).Warn("no command handles modal", "customId", data.CustomID)
+		return
+	}
+
+	if !srv.enforcePermissions(event, name) {
+		return
+	}
+
+	resp, err := cmd.HandleModal(event, data, args)
+	if err != nil {
+		srv.reportError(event, name, err)
+		return
+	}
+
+	if err := srv.Session.RespondInteraction(event.ID, event.Token, *resp); err != nil {
+		interactionLogger(event, name).Error("failed to send interaction callback", "err", err)
+	}
+}
+
+// handleAutocompleteInteraction asks the command for suggestions for the option the user is typing in
+func (srv *Server) handleAutocompleteInteraction(
+	event *gateway.InteractionCreateEvent,
+	data *discord.AutocompleteInteraction,
+) {
+	cmd, exists := srv.commands[data.Name]
+	if !exists || cmd.HandleAutocomplete == nil {
+		interactionLogger(event, data.Name).Warn("no command handles autocomplete")
+		return
+	}
+
+	// the options of a subcommand are nested within the subcommand and its group
+	ops := data.Options
+	for len(ops) == 1 && (ops[0].Type == discord.SubcommandOptionType || ops[0].Type == discord.SubcommandGroupOptionType) {
+		ops = ops[0].Options
+	}
+
+	options := make(map[string]discord.AutocompleteOption)
+	var focused discord.AutocompleteOption
+	for _, op := range ops {
+		options[op.Name] = op
+		if op.Focused {
+			focused = op
+		}
+	}
+
+	// suggestions may reveal what the command manages, so only those who may use it get any
+	reason, err := srv.checkPermissions(event, data.Name)
+	if err != nil {
+		interactionLogger(event, data.Name).Error("error occurred checking permissions", "err", err)
+		return
+	}
+
+	var choices []api.AutocompleteChoice
+	if reason == "" {
+		choices, err = cmd.HandleAutocomplete(event, focused, options)
+		if err != nil {
+			interactionLogger(event, data.Name).Error("error occurred handling autocomplete interaction", "err", err)
+			return
+		}
+	}
+
+	// discord rejects more than 25 suggestions
+	if len(choices) > 25 {
+		choices = choices[:25]
+	}
+
+	interactionResp := api.InteractionResponse{
+		Type: api.AutocompleteResult,
+		Data: &api.InteractionResponseData{
+			Choices: &choices,
+		},
+	}
+	if err := srv.Session.RespondInteraction(event.ID, event.Token, interactionResp); err != nil {
+		interactionLogger(event, data.Name).Error("failed to send autocomplete callback", "err", err)
+	}
+}
+
+// PaginatedResponse stores the given pages and returns a response showing the first page
+// together with buttons for paging through the rest. The buttons are routed to the command
+// with the given name, which should pass them on to PageResponse.
+func (srv *Server) PaginatedResponse(commandName string, pages []string) *api.InteractionResponseData {
+	id := srv.Pages.Add(pages)
+	content, current, total, _ := srv.Pages.Page(id, 0)
+
+	return &api.InteractionResponseData{
+		Content:    option.NewNullableString(content),
+		Components: pagination.Components(commandName, id, current, total),
+	}
+}
+
+// PageResponse responds to a click on a button created by PaginatedResponse by showing the requested page
+func (srv *Server) PageResponse(commandName string, args []string) (*api.InteractionResponse, error) {
+	id, page, ok := pagination.ParseArgs(args)
+	if !ok {
+		return nil, fmt.Errorf("malformed pagination arguments %q", args)
+	}
+
+	content, current, total, ok := srv.Pages.Page(id, page)
+	if !ok {
+		return &api.InteractionResponse{
+			Type: api.MessageInteractionWithSource,
+			Data: &api.InteractionResponseData{
+				Content: option.NewNullableString("this list has expired, please run the command again."),
+				Flags:   api.EphemeralResponse,
+			},
+		}, nil
+	}
+
+	return &api.InteractionResponse{
+		Type: api.UpdateMessage,
+		Data: &api.InteractionResponseData{
+			Content:    option.NewNullableString(content),
+			Components: pagination.Components(commandName, id, current, total),
+		},
+	}, nil
 }
 
 //revive:disable-next-line:cyclomatic
@@ -125,31 +421,23 @@ func (srv *Server) handleCommandInteraction(
 
 	options, err := opsToMap(data.Options)
 	if err != nil {
-		log.Printf("error occurred converting ops to a map: %v", err)
+		srv.reportError(event, data.Name, fmt.Errorf("converting ops to a map: %v", err))
 		return
 	}
 
 	cmd, exists := srv.commands[data.Name]
 	if !exists {
-		log.Printf("command %s does not exist", data.Name)
+		srv.reportError(event, data.Name, fmt.Errorf("command %s does not exist", data.Name))
+		return
+	}
+
+	if !srv.enforcePermissions(event, data.Name) || !srv.enforceCooldown(event, data.Name) {
 		return
 	}
 
 	responseData, err := cmd.HandleInteraction(event, options)
 	if err != nil {
-		log.Printf("error occurred handling interaction: %v", err)
-		dm, dmErr := srv.Session.CreatePrivateChannel(event.Member.User.ID)
-		if dmErr != nil {
-			log.Printf("error occurred creating private channel to report error: %v", dmErr)
-			return
-		}
-
-		_, dmErr = srv.Session.SendMessage(dm.ID, err.Error())
-		if dmErr != nil {
-			log.Printf("error occurred sending DM to report error: %v", dmErr)
-			return
-		}
-
+		srv.reportError(event, data.Name, err)
 		return
 	}
 
@@ -158,11 +446,11 @@ func (srv *Server) handleCommandInteraction(
 		Data: responseData,
 	}
 	if err := srv.Session.RespondInteraction(event.ID, event.Token, interactionResp); err != nil {
-		log.Printf("failed to send interaction callback: %v", err)
+		interactionLogger(event, data.Name).Error("failed to send interaction callback", "err", err)
 		return
 	}
 
-	log.Printf("responded to interaction")
+	interactionLogger(event, data.Name).Debug("responded to interaction")
 }
 
 // DeleteGuildCommands deletes all guild commands for the configured guild and app ID
@@ -180,7 +468,7 @@ func (srv *Server) DeleteGuildCommands() error {
 		if err != nil {
 			return fmt.Errorf("deleting command %s: %v", cmd.Name, err)
 		}
-		log.Printf("deleted guild command (%d/%d) %q", i+1, len(cmds), cmd.Name)
+		slog.Info("deleted guild command", "guild", srv.GuildID, "command", cmd.Name, "index", i+1, "count", len(cmds))
 	}
 
 	return nil
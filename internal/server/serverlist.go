@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// serverListTimeout bounds how long fetching a server list URL may take
+	serverListTimeout = 10 * time.Second
+	// maxServerListSize is the largest server list response read, in bytes
+	maxServerListSize = 1 << 20
+)
+
+// fetchServerList fetches a list of server addresses from the URL. The response is either a JSON
+// array of "host:port" strings, or an object with such an array under "servers".
+func fetchServerList(ctx context.Context, url string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, serverListTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching server list: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching server list: unexpected status %s", resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxServerListSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading server list: %v", err)
+	}
+
+	var servers []string
+	if err := json.Unmarshal(b, &servers); err == nil {
+		return servers, nil
+	}
+
+	var wrapped struct {
+		Servers []string `json:"servers"`
+	}
+	if err := json.Unmarshal(b, &wrapped); err != nil {
+		return nil, fmt.Errorf("unmarshalling server list: %v", err)
+	}
+	return wrapped.Servers, nil
+}
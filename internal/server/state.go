@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// state is the runtime data kept across restarts, as opposed to the config
+type state struct {
+	CountHistory map[string]countState `json:"countHistory"`
+}
+
+type countState struct {
+	Counts string    `json:"counts"`
+	Since  time.Time `json:"since"`
+	Seen   time.Time `json:"seen"`
+}
+
+// loadState restores the state saved by saveState, if a state file is configured and exists
+func (srv *Server) loadState() error {
+	if srv.StatePath == "" {
+		return nil
+	}
+
+	f, err := ioutil.ReadFile(srv.StatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading state: %v", err)
+	}
+
+	var st state
+	if err := json.Unmarshal(f, &st); err != nil {
+		return fmt.Errorf("unmarshalling state: %v", err)
+	}
+
+	srv.countHistoryMutex.Lock()
+	defer srv.countHistoryMutex.Unlock()
+	for address, c := range st.CountHistory {
+		// state files from before seen was saved give the servers a full horizon to show up again
+		if c.Seen.IsZero() {
+			c.Seen = time.Now()
+		}
+		srv.countHistory[address] = countRecord{counts: c.Counts, since: c.Since, seen: c.Seen}
+	}
+
+	slog.Info("restored state", "servers", len(st.CountHistory), "path", srv.StatePath)
+	return nil
+}
+
+// saveState writes the state to the configured state file, if any
+func (srv *Server) saveState() error {
+	if srv.StatePath == "" {
+		return nil
+	}
+
+	srv.pruneCountHistory()
+
+	st := state{CountHistory: make(map[string]countState)}
+	srv.countHistoryMutex.Lock()
+	for address, c := range srv.countHistory {
+		st.CountHistory[address] = countState{Counts: c.counts, Since: c.since, Seen: c.seen}
+	}
+	srv.countHistoryMutex.Unlock()
+
+	b, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("marshalling state: %v", err)
+	}
+
+	if err := ioutil.WriteFile(srv.StatePath, b, 0600); err != nil {
+		return fmt.Errorf("writing state: %v", err)
+	}
+	return nil
+}
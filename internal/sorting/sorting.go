@@ -0,0 +1,110 @@
+package sorting
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// The orders a server list can be sorted in
+const (
+	Players   = "players"
+	Hostname  = "hostname"
+	Map       = "map"
+	Ping      = "ping"
+	FreeSlots = "free"
+)
+
+// Default is the order used when none is given
+const Default = Players
+
+// Choices are the sort orders offered by the list commands
+var Choices = []discord.StringChoice{
+	{Name: "most players", Value: Players},
+	{Name: "hostname", Value: Hostname},
+	{Name: "map", Value: Map},
+	{Name: "lowest ping", Value: Ping},
+	{Name: "most free slots", Value: FreeSlots},
+}
+
+func intField(s map[string]string, key string) int {
+	i, err := strconv.Atoi(s[key])
+	if err != nil {
+		return 0
+	}
+	return i
+}
+
+func players(s map[string]string) int {
+	return intField(s, "clients") - intField(s, "bots")
+}
+
+func freeSlots(s map[string]string) int {
+	return intField(s, "sv_maxclients") - intField(s, "clients")
+}
+
+// Sort sorts the servers in place in the given order, falling back to Default for unknown orders.
+// Ties are broken by hostname so the list doesn't shuffle between refreshes.
+func Sort(servers []map[string]string, order string) {
+	byHostname := func(i, j int) bool {
+		hi, hj := strings.ToLower(servers[i]["hostname"]), strings.ToLower(servers[j]["hostname"])
+		if hi != hj {
+			return hi < hj
+		}
+		return servers[i]["ip"] < servers[j]["ip"]
+	}
+
+	var less func(i, j int) bool
+	switch order {
+	case Hostname:
+		less = byHostname
+	case Map:
+		less = func(i, j int) bool {
+			mi, mj := strings.ToLower(servers[i]["mapname"]), strings.ToLower(servers[j]["mapname"])
+			if mi != mj {
+				return mi < mj
+			}
+			return byHostname(i, j)
+		}
+	case Ping:
+		less = func(i, j int) bool {
+			pi, pj := intField(servers[i], "ping"), intField(servers[j], "ping")
+			if pi != pj {
+				return pi < pj
+			}
+			return byHostname(i, j)
+		}
+	case FreeSlots:
+		less = func(i, j int) bool {
+			fi, fj := freeSlots(servers[i]), freeSlots(servers[j])
+			if fi != fj {
+				return fi > fj
+			}
+			return byHostname(i, j)
+		}
+	default:
+		less = func(i, j int) bool {
+			pi, pj := players(servers[i]), players(servers[j])
+			if pi != pj {
+				return pi > pj
+			}
+			ci, cj := intField(servers[i], "clients"), intField(servers[j], "clients")
+			if ci != cj {
+				return ci > cj
+			}
+			return byHostname(i, j)
+		}
+	}
+
+	sort.SliceStable(servers, less)
+}
+
+// OrderOption reads the sort order from the options of a command, returning Default if it is absent
+func OrderOption(options map[string]discord.CommandInteractionOption) string {
+	if val, present := options["sort"]; present {
+		return val.String()
+	}
+	return Default
+}
@@ -3,8 +3,11 @@ package stringformat
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/trondhumbor/pigeon/internal/colors"
 	"github.com/trondhumbor/pigeon/internal/server"
 )
 
@@ -33,45 +36,90 @@ func sanitizeFields(inServer server.GameServer) server.GameServer {
 }
 
 type Formatter struct {
-	mapnames  map[string]string
-	gametypes map[string]string
+	// aliases returns the current mapname and gametype aliases, which can change at runtime
+	aliases func() (mapnames, gametypes map[string]string)
+	// ansi renders hostnames in their colors, in ansi code blocks
+	ansi bool
 }
 
-func New(mapnames, gametypes map[string]string) (f Formatter) {
-	return Formatter{mapnames: mapnames, gametypes: gametypes}
+func New(aliases func() (mapnames, gametypes map[string]string)) (f Formatter) {
+	return Formatter{aliases: aliases}
+}
+
+// WithColors returns a copy of the formatter which renders hostnames in their in-game colors if
+// enabled. Discord only shows the colors on desktop.
+func (f Formatter) WithColors(enabled bool) Formatter {
+	f.ansi = enabled
+	return f
 }
 
 func (f *Formatter) MapnameLookup(key string) string {
-	if val, present := f.mapnames[key]; present {
+	mapnames, _ := f.aliases()
+	if val, present := mapnames[key]; present {
 		return val
 	}
 	return "Unknown" // could potentially return the key here instead
 }
 
 func (f *Formatter) GametypeLookup(key string) string {
-	if val, present := f.gametypes[key]; present {
+	_, gametypes := f.aliases()
+	if val, present := gametypes[key]; present {
 		return val
 	}
 	return "Unknown" // could potentially return the key here instead
 }
 
+// codeBlock returns the start of a code block for the lists
+func (f *Formatter) codeBlock() string {
+	if f.ansi {
+		return "```ansi\n"
+	}
+	return "```\n"
+}
+
+// hostname returns the hostname of the server cut off or padded to width, followed by the suffix,
+// and in its colors if the formatter renders them
+func (f *Formatter) hostname(s server.GameServer, width int, suffix string) string {
+	spans := []colors.Span{{Text: s["hostname"], Color: colors.Default}}
+	if f.ansi {
+		spans = colors.Parse(colors.Raw(s, "hostname"))
+	}
+
+	spans = colors.Truncate(spans, width-len(suffix))
+	if suffix != "" {
+		spans = colors.TrimRight(spans)
+	}
+	padding := strings.Repeat(" ", width-colors.Len(spans)-len(suffix))
+
+	if f.ansi {
+		return colors.ANSI(spans) + suffix + padding
+	}
+	return colors.Plain(spans) + suffix + padding
+}
+
 func (f *Formatter) DesktopList(servers []server.GameServer) []string {
 	var messages []string
-	desc := "```\n"
+	desc := f.codeBlock()
 	for _, s := range servers {
-		// if the next server will exceed the discord char limit, cut it off and start on a new message
-		if len(desc)+100 > 2000 {
-			desc += "```"
-			messages = append(messages, desc)
-			desc = "```\n"
-		}
-
 		s = sanitizeFields(s)
-		hostname := leftjust(s["hostname"], 40)
+		tag := staleness(s)
+		if tag != "" {
+			// the tag replaces the end of long hostnames, so the columns stay aligned
+			tag = " (" + tag + ")"
+		}
+		hostname := f.hostname(s, 40, tag)
 		mapname := leftjust(f.MapnameLookup(s["mapname"]), 12)
 		gametype := leftjust(f.GametypeLookup(s["gametype"]), 7)
 		clients := leftjust(fmt.Sprintf("%s / %s (%s)", s["clients"], s["sv_maxclients"], s["bots"]), 12)
-		desc += fmt.Sprintf("| %s | %s | %s | %s |\n", hostname, mapname, gametype, clients)
+		line := fmt.Sprintf("| %s | %s | %s | %s |\n", hostname, mapname, gametype, clients)
+
+		// if the next server will exceed the discord char limit, cut it off and start on a new message
+		if len(desc)+len(line)+3 > 2000 {
+			desc += "```"
+			messages = append(messages, desc)
+			desc = f.codeBlock()
+		}
+		desc += line
 	}
 	desc += "```"
 	messages = append(messages, desc)
@@ -80,28 +128,57 @@ func (f *Formatter) DesktopList(servers []server.GameServer) []string {
 
 func (f *Formatter) MobileList(servers []server.GameServer) []string {
 	var messages []string
-	desc := "```\n---------------------------------\n"
+	desc := f.codeBlock() + "---------------------------------\n"
 	for _, s := range servers {
-		// if the next server will exceed the discord char limit, cut it off and start on a new message
-		if len(desc)+200 > 2000 {
-			desc += "```"
-			messages = append(messages, desc)
-			desc = "```\n---------------------------------\n"
-		}
-
 		s = sanitizeFields(s)
-		hostname := fmt.Sprintf("|%-8s|%s|", "Hostname", leftjust(s["hostname"], 22))
+		hostname := fmt.Sprintf("|%-8s|%s|", "Hostname", f.hostname(s, 22, ""))
 		mapname := fmt.Sprintf("|%-8s|%s|", "Map", leftjust(f.MapnameLookup(s["mapname"]), 22))
 		gametype := fmt.Sprintf("|%-8s|%s|", "Gametype", leftjust(f.GametypeLookup(s["gametype"]), 22))
 		clients := fmt.Sprintf("|%-8s|%s|", "Clients", leftjust(fmt.Sprintf("%s / %s (%s)", s["clients"], s["sv_maxclients"], s["bots"]), 22))
-		desc += fmt.Sprintf("%s\n%s\n%s\n%s\n", hostname, mapname, gametype, clients)
-		desc += "---------------------------------\n"
+		entry := fmt.Sprintf("%s\n%s\n%s\n%s\n", hostname, mapname, gametype, clients)
+		if tag := staleness(s); tag != "" {
+			entry += fmt.Sprintf("|%-8s|%s|\n", "Status", leftjust(tag, 22))
+		}
+		entry += "---------------------------------\n"
+
+		// if the next server will exceed the discord char limit, cut it off and start on a new message
+		if len(desc)+len(entry)+3 > 2000 {
+			desc += "```"
+			messages = append(messages, desc)
+			desc = f.codeBlock() + "---------------------------------\n"
+		}
+		desc += entry
 	}
 	desc += "```"
 	messages = append(messages, desc)
 	return messages
 }
 
+// staleness describes how long ago a server kept from an earlier refresh was last seen, or
+// returns an empty string if it responded in the last refresh
+func staleness(s server.GameServer) string {
+	if !server.IsStale(s) {
+		return ""
+	}
+	seen, ok := server.LastSeen(s)
+	if !ok {
+		return "stale"
+	}
+	return "seen " + shortDuration(time.Since(seen)) + " ago"
+}
+
+// shortDuration formats d in its largest whole unit, e.g. "4m"
+func shortDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+}
+
 func (f *Formatter) Stats(totalservers, totalclients, totalbots int) string {
 	desc := "```\n----------------------\n"
 
@@ -114,3 +191,92 @@ func (f *Formatter) Stats(totalservers, totalclients, totalbots int) string {
 	desc += "```"
 	return desc
 }
+
+// Excluded summarizes how many servers were left out of a list and why, or returns an empty
+// string if none were
+func (f *Formatter) Excluded(reasons map[string]int) string {
+	var total int
+	var keys []string
+	for reason, n := range reasons {
+		total += n
+		keys = append(keys, reason)
+	}
+	if total == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, reason := range keys {
+		parts = append(parts, fmt.Sprintf("%d %s", reasons[reason], reason))
+	}
+	return fmt.Sprintf("%d servers excluded: %s", total, strings.Join(parts, ", "))
+}
+
+// Stale summarizes how many servers which didn't respond in the last refresh were left out of the
+// stats, or returns an empty string if none were
+func (f *Formatter) Stale(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d servers not responding, left out of the totals", n)
+}
+
+// WithFooter appends the footer to every page it fits on without exceeding the discord char limit
+func (f *Formatter) WithFooter(pages []string, footer string) []string {
+	if footer == "" {
+		return pages
+	}
+
+	ret := make([]string, len(pages))
+	for i, p := range pages {
+		if len(p)+len(footer)+1 <= 2000 {
+			p += "\n" + footer
+		}
+		ret[i] = p
+	}
+	return ret
+}
+
+func (f *Formatter) Health(h server.Health) string {
+	desc := "```\n"
+	desc += fmt.Sprintf("%-15s %s\n", "Uptime", h.Uptime.Round(time.Second))
+	desc += fmt.Sprintf("%-15s %s\n", "Gateway", gatewayState(h))
+	desc += fmt.Sprintf("%-15s %s\n", "Last refresh", since(h.LastRefresh))
+	desc += fmt.Sprintf("%-15s %d\n", "Masters failing", h.MastersFailing)
+	desc += fmt.Sprintf("%-15s %d\n", "Goroutines", h.Goroutines)
+	desc += fmt.Sprintf("%-15s %d\n", "Tasks", h.Tasks)
+	desc += "\n"
+
+	desc += fmt.Sprintf("| %s | %-7s | %-8s | %-12s | %-8s |\n", leftjust("Game", 16), "Servers", "Excluded", "Last success", "State")
+	for _, g := range h.Games {
+		state := "ok"
+		switch {
+		case g.Disabled:
+			state = "disabled"
+		case g.Failing:
+			state = "failing"
+		}
+		desc += fmt.Sprintf(
+			"| %s | %-7d | %-8d | %-12s | %-8s |\n",
+			leftjust(g.GameId, 16), g.Servers, g.Excluded, since(g.LastSuccess), state,
+		)
+	}
+	desc += "```"
+	return desc
+}
+
+func gatewayState(h server.Health) string {
+	if h.GatewayConnected {
+		return fmt.Sprintf("connected (heartbeat %s)", since(h.LastHeartbeatAck))
+	}
+	return fmt.Sprintf("disconnected (heartbeat %s)", since(h.LastHeartbeatAck))
+}
+
+// since formats the time passed since t, e.g. "1m30s ago"
+func since(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return time.Since(t).Round(time.Second).String() + " ago"
+}
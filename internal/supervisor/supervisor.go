@@ -0,0 +1,116 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+)
+
+// PanicError is returned by Run when the task panicked
+type PanicError struct {
+	Task      string
+	Recovered interface{}
+	Stack     []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task %s panicked: %v", e.Task, e.Recovered)
+}
+
+// Supervisor runs tasks, recovering them from panics and keeping track of those in flight
+type Supervisor struct {
+	// onPanic is called with the recovered panics of tasks started with Go, after they have been logged
+	onPanic func(*PanicError)
+
+	wg       sync.WaitGroup
+	inFlight map[string]int
+	mutex    sync.Mutex
+}
+
+// New creates a supervisor which calls onPanic, if not nil, whenever a task started with Go panics
+func New(onPanic func(*PanicError)) *Supervisor {
+	return &Supervisor{onPanic: onPanic, inFlight: make(map[string]int)}
+}
+
+// Run runs the task in the current goroutine, returning a *PanicError if it panicked.
+// The panic is logged, but left to the caller to report.
+func (s *Supervisor) Run(name string, task func()) error {
+	s.start(name)
+	defer s.done(name)
+	return s.run(name, task)
+}
+
+// Go runs the task in a new goroutine
+func (s *Supervisor) Go(name string, task func()) {
+	// the task is counted before the goroutine starts, so Wait can't miss it
+	s.start(name)
+	go func() {
+		defer s.done(name)
+
+		var perr *PanicError
+		if err := s.run(name, task); errors.As(err, &perr) && s.onPanic != nil {
+			s.onPanic(perr)
+		}
+	}()
+}
+
+func (s *Supervisor) run(name string, task func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			perr := &PanicError{Task: name, Recovered: r, Stack: debug.Stack()}
+			slog.Error("task panicked", "task", name, "panic", fmt.Sprint(r), "stack", string(perr.Stack))
+			err = perr
+		}
+	}()
+
+	task()
+	return nil
+}
+
+func (s *Supervisor) start(name string) {
+	s.wg.Add(1)
+	s.mutex.Lock()
+	s.inFlight[name]++
+	s.mutex.Unlock()
+}
+
+func (s *Supervisor) done(name string) {
+	s.mutex.Lock()
+	s.inFlight[name]--
+	if s.inFlight[name] == 0 {
+		delete(s.inFlight, name)
+	}
+	s.mutex.Unlock()
+	s.wg.Done()
+}
+
+// InFlight returns how many tasks are running, by name
+func (s *Supervisor) InFlight() map[string]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	inFlight := make(map[string]int, len(s.inFlight))
+	for name, n := range s.inFlight {
+		inFlight[name] = n
+	}
+	return inFlight
+}
+
+// Wait waits for all tasks to finish, giving up when the context ends
+func (s *Supervisor) Wait(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}